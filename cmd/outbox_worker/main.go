@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"loshon-api/internals/config"
+	"loshon-api/internals/data"
+	"loshon-api/internals/outbox"
+	"loshon-api/internals/search"
+	"os/signal"
+	"syscall"
+)
+
+/*
+	USAGE: DRAIN THE SEARCH OUTBOX OUTSIDE OF THE API PROCESS
+	-once drains whatever is due and exits, otherwise polls until interrupted
+*/
+
+func main() {
+	once := flag.Bool("once", false, "drain due entries once and exit")
+	flag.Parse()
+
+	config, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("failed to load config %v", err)
+	}
+
+	gormdb, err := data.OpenDB(config.PostgresUrl)
+	if err != nil {
+		log.Fatalf("failed to open db %v", err)
+	}
+
+	searchClient, err := search.NewBackend(config.SearchBackend, config.AngoliaAppID, config.AngoliaAPIKey, gormdb)
+	if err != nil {
+		log.Fatalf("failed to create search client %v", err)
+	}
+
+	worker := outbox.NewWorker(
+		data.NewOutboxRepository(gormdb),
+		data.NewDocumentRepository(gormdb),
+		searchClient,
+		config.SearchIndex,
+		outbox.NewOptions(config),
+	)
+
+	if *once {
+		n, err := worker.Drain()
+		if err != nil {
+			log.Fatalf("failed to drain outbox %v", err)
+		}
+		log.Printf("drained %d outbox entries", n)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	worker.Run(ctx)
+}
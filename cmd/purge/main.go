@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+	"loshon-api/internals/config"
+	"loshon-api/internals/data"
+	"loshon-api/internals/purge"
+)
+
+/*
+	USAGE: PERMANENTLY DELETE THE DOCUMENTS KEPT IN THE TRASH FOR LONGER THAN TRASH_RETENTION_DAYS
+*/
+
+func main() {
+	config, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("failed to load config %v", err)
+	}
+	if config.TrashRetentionDays == 0 {
+		log.Fatalf("trash retention is disabled, set TRASH_RETENTION_DAYS")
+	}
+
+	gormdb, err := data.OpenDB(config.PostgresUrl)
+	if err != nil {
+		log.Fatalf("failed to open db %v", err)
+	}
+
+	worker := purge.NewWorker(data.NewDocumentRepository(gormdb), purge.NewOptions(config))
+	n, err := worker.Purge()
+	if err != nil {
+		log.Fatalf("failed to purge trash after %d documents %v", n, err)
+	}
+	log.Printf("purged %d documents", n)
+}
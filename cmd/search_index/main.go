@@ -1,41 +1,181 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"loshon-api/internals/config"
 	"loshon-api/internals/data"
 	"loshon-api/internals/search"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 /*
-	USAGE: INITIALIZE SEARCH INDEX WITH ALL CURRENT DOCUMENTS IN DB
+	USAGE: SYNC THE SEARCH INDEX WITH THE DOCUMENTS IN DB
+	-since only pushes documents updated after a RFC3339 time or a duration ago (e.g. 24h)
+	-user only syncs the documents of a single user
+	-batch-size sets how many documents are read and pushed at once
+	-diff reports index objects whose document is deleted or gone from DB
+	-prune deletes those objects from the index, implies -diff
+	-dry-run reports what would change without writing to the index
 */
 
 func main() {
+	since := flag.String("since", "", "only sync documents updated after this RFC3339 time or duration ago")
+	userID := flag.String("user", "", "only sync the documents of this user")
+	batchSize := flag.Int("batch-size", 500, "documents read and indexed per batch")
+	diff := flag.Bool("diff", false, "report index objects missing from the database")
+	prune := flag.Bool("prune", false, "delete index objects missing from the database, implies -diff")
+	dryRun := flag.Bool("dry-run", false, "report changes without writing to the index")
+	flag.Parse()
+
+	if *batchSize <= 0 {
+		log.Fatalf("batch-size must be positive")
+	}
+	watermark, err := parseSince(*since)
+	if err != nil {
+		log.Fatalf("invalid since %v", err)
+	}
+
 	config, err := config.LoadConfig()
 	if err != nil {
 		log.Fatalf("failed to load config %v", err)
 	}
 
-	searchClient, err := search.NewSearchClient(config.AngoliaAppID, config.AngoliaAPIKey)
+	gormdb, err := data.OpenDB(config.PostgresUrl)
+	if err != nil {
+		log.Fatalf("failed to open db %v", err)
+	}
+
+	searchClient, err := search.NewBackend(config.SearchBackend, config.AngoliaAppID, config.AngoliaAPIKey, gormdb)
 	if err != nil {
 		log.Fatalf("failed to create search client %v", err)
 	}
 
-	gormdb, err := data.OpenDB(config.PostgresUrl)
+	documentRepo := data.NewDocumentRepository(gormdb)
+
+	// deletions only touch deleted_at, so they count as updates too
+	query, args := "1 = 1", []any{}
+	if !watermark.IsZero() {
+		query += " AND (updated_at >= ? OR deleted_at >= ?)"
+		args = append(args, watermark, watermark)
+	}
+	if *userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, *userID)
+	}
+
+	indexed := 0
+	err = documentRepo.Stream(*batchSize, func(documents []data.Document) error {
+		indexed += len(documents)
+		if *dryRun {
+			return nil
+		}
+		// deleted documents are removed from the index rather than saved
+		documentSearchObjects := make([]map[string]any, 0, len(documents))
+		deletedIDs := []string{}
+		for _, doc := range documents {
+			if doc.DeletedAt.Valid {
+				deletedIDs = append(deletedIDs, doc.ID.String())
+				continue
+			}
+			documentSearchObjects = append(documentSearchObjects, doc.ToSearchObject())
+		}
+		if len(documentSearchObjects) > 0 {
+			if err := searchClient.Reindex(config.SearchIndex, documentSearchObjects); err != nil {
+				return err
+			}
+		}
+		return searchClient.DeleteObjects(config.SearchIndex, deletedIDs)
+	}, query, args...)
 	if err != nil {
-		log.Fatalf("failed to open db %v", err)
+		log.Fatalf("failed to index documents after %d %v", indexed, err)
+	}
+	if *dryRun {
+		log.Printf("would index %d documents", indexed)
+	} else {
+		log.Printf("indexed %d documents", indexed)
 	}
 
-	documents := []data.Document{}
-	if err := gormdb.Unscoped().Find(&documents).Error; err != nil {
-		log.Fatalf("failed to fetch documents %v", err)
+	if !*diff && !*prune {
+		return
+	}
+	browser, ok := searchClient.(search.Browser)
+	if !ok {
+		log.Fatalf("search backend %s cannot be browsed", config.SearchBackend)
 	}
 
-	documentSearchObjects := []map[string]any{}
-	for _, doc := range documents {
-		documentSearchObjects = append(documentSearchObjects, doc.ToSearchObject())
+	orphans := 0
+	err = browser.BrowseObjectIDs(config.SearchIndex, *userID, func(ids []string) error {
+		missing, err := missingDocuments(documentRepo, ids)
+		if err != nil {
+			return err
+		}
+		for _, id := range missing {
+			log.Printf("orphan object %s", id)
+		}
+		orphans += len(missing)
+		if !*prune || *dryRun || len(missing) == 0 {
+			return nil
+		}
+		return searchClient.DeleteObjects(config.SearchIndex, missing)
+	})
+	if err != nil {
+		log.Fatalf("failed to diff search index %v", err)
+	}
+	switch {
+	case *prune && !*dryRun:
+		log.Printf("pruned %d orphan objects", orphans)
+	case *prune:
+		log.Printf("would prune %d orphan objects", orphans)
+	default:
+		log.Printf("found %d orphan objects", orphans)
+	}
+}
+
+// Accept either an absolute RFC3339 time or a duration counted back from now
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a RFC3339 time nor a duration", value)
 	}
+	return time.Now().Add(-d), nil
+}
 
-	searchClient.Reindex(config.SearchIndex, documentSearchObjects)
+// Object IDs without a matching live row. Deleted documents do not belong in
+// the index either, and IDs that are not even UUIDs can never match a row.
+func missingDocuments(repo data.DocumentRepositoryInterface, objectIDs []string) ([]string, error) {
+	missing := []string{}
+	ids := make([]uuid.UUID, 0, len(objectIDs))
+	for _, objectID := range objectIDs {
+		id, err := uuid.Parse(objectID)
+		if err != nil {
+			missing = append(missing, objectID)
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	documents, err := repo.Find(ids)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[uuid.UUID]bool, len(documents))
+	for _, doc := range documents {
+		found[doc.ID] = !doc.DeletedAt.Valid
+	}
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id.String())
+		}
+	}
+	return missing, nil
 }
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"errors"
+	"loshon-api/internals/data"
+	"loshon-api/internals/validator"
+	"net/http"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func (app App) GetAPITokens(c echo.Context) error {
+	var user *clerk.User
+	var tokens []data.APIToken
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+	if err := requireSession(c); err != nil {
+		return err
+	}
+
+	tokens, err := app.apiTokenRepo.Get(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[[]data.APIToken]{
+		Data:  tokens,
+		Total: int(len(tokens)),
+	})
+}
+
+func (app App) CreateAPIToken(c echo.Context) error {
+	var user *clerk.User
+	createData := CreateAPITokenRequest{}
+	v := validator.NewValidator()
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+	if err := requireSession(c); err != nil {
+		return err
+	}
+
+	if err := c.Bind(&createData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request object")
+	}
+	if err := v.ValidateStruct(createData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	if createData.ExpiresAt != nil && !createData.ExpiresAt.After(time.Now()) {
+		return validator.NewStructValidationErrors(
+			validator.NewFieldError("expiresAt", "future", "", createData.ExpiresAt.Format(time.RFC3339)),
+		).TranslateToHttpError()
+	}
+
+	token := data.APIToken{
+		UserID:    user.ID,
+		Name:      createData.Name,
+		Scope:     createData.Scope,
+		ExpiresAt: createData.ExpiresAt,
+	}
+	if err := token.GenerateToken(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if err := app.apiTokenRepo.Save(&token); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, Response[data.APIToken]{
+		Data: token,
+	})
+}
+
+func (app App) RevokeAPIToken(c echo.Context) error {
+	var user *clerk.User
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+	if err := requireSession(c); err != nil {
+		return err
+	}
+
+	tokenID := c.Param("tokenID")
+	if err := uuid.Validate(tokenID); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "api token not found")
+	}
+	if err := app.apiTokenRepo.Revoke(user.ID, tokenID); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	return c.JSON(http.StatusOK, echo.Map{})
+}
+
+// Tokens cannot manage tokens
+func requireSession(c echo.Context) error {
+	if _, ok := c.Get("apiToken").(*data.APIToken); ok {
+		return echo.NewHTTPError(http.StatusForbidden, "api tokens cannot manage api tokens")
+	}
+	return nil
+}
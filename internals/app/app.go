@@ -6,19 +6,37 @@ import (
 	"log/slog"
 	"loshon-api/internals/config"
 	"loshon-api/internals/data"
+	"loshon-api/internals/outbox"
+	"loshon-api/internals/policy"
+	"loshon-api/internals/purge"
 	"loshon-api/internals/search"
 	"os"
 
 	"github.com/clerk/clerk-sdk-go/v2"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
 )
 
 type App struct {
-	engine  *echo.Echo
-	config  *config.AppConfig
-	sclient *search.SearchClient
-    documentRepo data.DocumentRepositoryInterface
+	engine         *echo.Echo
+	config         *config.AppConfig
+	db             *gorm.DB
+	sclient        search.Backend
+	documentRepo   data.DocumentRepositoryInterface
+	revisionRepo   data.RevisionRepositoryInterface
+	templateRepo   data.TemplateRepositoryInterface
+	permissionRepo data.PermissionRepositoryInterface
+	shareLinkRepo  data.ShareLinkRepositoryInterface
+	workspaceRepo  data.WorkspaceRepositoryInterface
+	apiTokenRepo   data.APITokenRepositoryInterface
+	policy         policy.Policy
+	workers        []Worker
+}
+
+// Background job started along with the HTTP server
+type Worker interface {
+	Run(ctx context.Context)
 }
 
 func NewApp() *App {
@@ -33,6 +51,7 @@ func NewApp() *App {
 	app.RegisterMiddlewares()
 	app.RegisterRepos()
 	app.RegisterSearchClient()
+	app.RegisterWorkers()
 	app.RegisterRoutes()
 
 	return app
@@ -51,23 +70,47 @@ func (app *App) RegisterRepos() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	app.db = db
 	app.documentRepo = data.NewDocumentRepository(db)
+	app.revisionRepo = data.NewRevisionRepository(db, revisionRetention(app.config))
+	app.templateRepo = data.NewTemplateRepository(db)
+	app.permissionRepo = data.NewPermissionRepository(db)
+	app.shareLinkRepo = data.NewShareLinkRepository(db)
+	app.workspaceRepo = data.NewWorkspaceRepository(db)
+	app.apiTokenRepo = data.NewAPITokenRepository(db)
+	app.policy = policy.New(app.permissionRepo)
 }
 
 func (app *App) RegisterSearchClient() {
-	sclient, err := search.NewSearchClient(app.config.AngoliaAppID, app.config.AngoliaAPIKey)
+	sclient, err := search.NewBackend(app.config.SearchBackend, app.config.AngoliaAppID, app.config.AngoliaAPIKey, app.db)
 	if err != nil {
 		log.Fatalf("cannot initialize search client %v", err)
 	}
 	app.sclient = sclient
 }
 
+func (app *App) RegisterWorkers() {
+	if app.config.OutboxWorkerEnabled {
+		app.workers = append(app.workers, outbox.NewWorker(
+			data.NewOutboxRepository(app.db),
+			app.documentRepo,
+			app.sclient,
+			app.config.SearchIndex,
+			outbox.NewOptions(app.config),
+		))
+	}
+	if app.config.PurgeWorkerEnabled && app.config.TrashRetentionDays > 0 {
+		app.workers = append(app.workers, purge.NewWorker(app.documentRepo, purge.NewOptions(app.config)))
+	}
+}
+
 func (app *App) RegisterMiddlewares() {
 	app.engine.Pre(middleware.RemoveTrailingSlash())
 	app.engine.Use(middleware.RequestID())
 	app.engine.Use(middleware.Recover())
 	app.engine.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
+		AllowOrigins:  []string{"*"},
+		ExposeHeaders: []string{"ETag"},
 	}))
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	app.engine.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
@@ -100,17 +143,62 @@ func (app *App) RegisterRoutes() {
 	api.GET("", app.healthCheck)
 
 	api.GET("/documents", app.GetDocuments, app.ClerkAuthMiddleware)
-	api.GET("/documents/:documentID", app.GetDocumentByID, app.OptionalClerkAuthMiddleware)
+	api.GET("/documents/_tree", app.GetDocumentTree, app.ClerkAuthMiddleware)
+	api.GET("/documents/:documentID", app.GetDocumentByID, app.OptionalClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionView))
+	api.GET("/documents/:documentID/ancestors", app.GetDocumentAncestors, app.OptionalClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionView))
 	api.POST("/documents", app.CreateDocument, app.ClerkAuthMiddleware)
-	api.PATCH("/documents/:documentID", app.UpdateDocument, app.ClerkAuthMiddleware)
-	api.DELETE("/documents/:documentID", app.ArchiveDocument, app.ClerkAuthMiddleware)
+	api.PATCH("/documents/:documentID", app.UpdateDocument, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionEdit))
+	api.DELETE("/documents/:documentID", app.ArchiveDocument, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionManage))
+	api.POST("/documents/:documentID/move", app.MoveDocument, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionManage))
+	api.POST("/documents/:documentID/duplicate", app.DuplicateDocument, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionManage))
+
+	api.GET("/documents/:documentID/permissions", app.GetDocumentPermissions, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionViewCollaborators))
+	api.POST("/documents/:documentID/permissions", app.GrantDocumentPermission, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionManage))
+	api.DELETE("/documents/:documentID/permissions/:userID", app.RevokeDocumentPermission, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionViewCollaborators))
+
+	api.GET("/documents/:documentID/share-links", app.GetShareLinks, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionManage))
+	api.POST("/documents/:documentID/share-links", app.CreateShareLink, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionManage))
+	api.DELETE("/documents/:documentID/share-links/:linkID", app.RevokeShareLink, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionManage))
+	api.GET("/shared/:token", app.GetSharedDocument, app.OptionalClerkAuthMiddleware)
+
+	api.POST("/documents/_bulk", app.BulkDocuments, app.ClerkAuthMiddleware)
 
 	api.GET("/documents/_archives", app.GetArchivedDocuments, app.ClerkAuthMiddleware)
-	api.PATCH("/documents/_restore/:documentID", app.RestoreArchivedDocument, app.ClerkAuthMiddleware)
-	api.DELETE("/documents/_delete/:documentID", app.DeleteArchivedDocument, app.ClerkAuthMiddleware)
+	api.PATCH("/documents/_restore/:documentID", app.RestoreArchivedDocument, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionManage))
+	api.DELETE("/documents/_delete/:documentID", app.DeleteArchivedDocument, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionManage))
+	api.GET("/documents/_deleted", app.GetDeletedDocuments, app.ClerkAuthMiddleware)
+	api.PATCH("/documents/_undelete/:documentID", app.UndeleteDocument, app.ClerkAuthMiddleware, app.DeletedDocumentPolicyMiddleware(policy.ActionManage))
+
+	api.GET("/workspaces", app.GetWorkspaces, app.ClerkAuthMiddleware)
+	api.POST("/workspaces", app.CreateWorkspace, app.ClerkAuthMiddleware)
+	api.GET("/workspaces/:workspaceID/members", app.GetWorkspaceMembers, app.ClerkAuthMiddleware, app.WorkspaceMiddleware(data.WorkspaceMember))
+	api.POST("/workspaces/:workspaceID/members", app.AddWorkspaceMember, app.ClerkAuthMiddleware, app.WorkspaceMiddleware(data.WorkspaceAdmin))
+	api.DELETE("/workspaces/:workspaceID/members/:userID", app.RemoveWorkspaceMember, app.ClerkAuthMiddleware, app.WorkspaceMiddleware(data.WorkspaceMember))
+	api.GET("/workspaces/:workspaceID/documents", app.GetWorkspaceDocuments, app.ClerkAuthMiddleware, app.WorkspaceMiddleware(data.WorkspaceMember))
+	api.GET("/workspaces/:workspaceID/archives", app.GetWorkspaceArchivedDocuments, app.ClerkAuthMiddleware, app.WorkspaceMiddleware(data.WorkspaceMember))
+
+	api.GET("/tokens", app.GetAPITokens, app.ClerkAuthMiddleware)
+	api.POST("/tokens", app.CreateAPIToken, app.ClerkAuthMiddleware)
+	api.DELETE("/tokens/:tokenID", app.RevokeAPIToken, app.ClerkAuthMiddleware)
+
+	api.GET("/search", app.SearchDocuments, app.ClerkAuthMiddleware)
+	api.GET("/search/key", app.GetSearchKey, app.ClerkAuthMiddleware)
+
+	api.GET("/templates", app.GetTemplates, app.ClerkAuthMiddleware)
+	api.POST("/templates", app.CreateTemplate, app.ClerkAuthMiddleware)
+
+	api.GET("/documents/:documentID/revisions", app.GetDocumentRevisions, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionViewHistory))
+	api.GET("/documents/:documentID/revisions/:revisionID", app.GetDocumentRevisionByID, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionViewHistory))
+	api.POST("/documents/:documentID/revisions/:revisionID/restore", app.RestoreDocumentRevision, app.ClerkAuthMiddleware, app.DocumentPolicyMiddleware(policy.ActionEdit))
 }
 
 func (app *App) Run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, worker := range app.workers {
+		go worker.Run(ctx)
+	}
+
 	addr := app.config.Port
 	if addr == "" {
 		addr = ":80"
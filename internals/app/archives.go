@@ -3,161 +3,192 @@ package app
 import (
 	"errors"
 	"loshon-api/internals/data"
+	"loshon-api/internals/purge"
+	"loshon-api/internals/validator"
 	"net/http"
+	"time"
 
 	"github.com/clerk/clerk-sdk-go/v2"
 	"github.com/labstack/echo/v4"
-	"gorm.io/gorm"
 )
 
 func (app App) ArchiveDocument(c echo.Context) error {
-	var user *clerk.User
-	var document *data.Document
-	var archivedDocuments []data.Document
-	var reindexObjects []map[string]any
-
-	user, ok := c.Get("user").(*clerk.User)
-	if !ok {
-		return echo.NewHTTPError(http.StatusInternalServerError, "invalid context")
-	}
-
-	documentID := c.Param("documentID")
-	document, err := app.documentRepo.First("id = ?", documentID)
+	document, err := contextDocument(c)
 	if err != nil {
-		switch {
-		case (errors.Is(err, gorm.ErrRecordNotFound)):
-			return echo.NewHTTPError(http.StatusNotFound, err)
-		default:
-			return echo.NewHTTPError(http.StatusInternalServerError, err)
-		}
-	}
-	if user.ID != document.UserID {
-		return echo.ErrForbidden
+		return err
 	}
-	if err := app.documentRepo.Archive(document); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
-
-	// reindex all archived documents
-	archivedDocuments, err = app.documentRepo.Get(map[string]any{"user_id": user.ID, "is_archived": true})
+	err = app.documentRepo.Transaction(func(tx data.DocumentRepositoryInterface) error {
+		// reindex only the documents that changed
+		affected, err := tx.Archive(document)
+		if err != nil {
+			return err
+		}
+		return tx.EnqueueIndex(data.IndexSave, affected...)
+	})
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
-	for _, ad := range archivedDocuments {
-		reindexObjects = append(reindexObjects, ad.ToSearchObject())
-	}
-	if err := app.sclient.Reindex(app.config.SearchIndex, reindexObjects); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
 
 	return c.JSON(http.StatusOK, echo.Map{})
 }
 
 func (app App) RestoreArchivedDocument(c echo.Context) error {
-	var user *clerk.User
-	var document *data.Document
-	var documents []data.Document
-	var reindexObjects []map[string]any
-
-	user, ok := c.Get("user").(*clerk.User)
-	if !ok {
-		return echo.ErrUnauthorized
-	}
-	documentID := c.Param("documentID")
-	document, err := app.documentRepo.First(map[string]any{"id": documentID})
+	document, err := contextDocument(c)
 	if err != nil {
-		switch {
-		case errors.Is(err, gorm.ErrRecordNotFound):
-			return echo.NewHTTPError(http.StatusNotFound, err)
-		default:
-			return echo.NewHTTPError(http.StatusInternalServerError, err)
-		}
-	}
-	if document.UserID != user.ID {
-		return echo.ErrForbidden
+		return err
 	}
-	if err := app.documentRepo.Restore(document); err != nil {
+	err = app.documentRepo.Transaction(func(tx data.DocumentRepositoryInterface) error {
+		// reindex only the documents that changed
+		affected, err := tx.Restore(document)
+		if err != nil {
+			return err
+		}
+		return tx.EnqueueIndex(data.IndexSave, affected...)
+	})
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	// reindex all unarchived documents
-	documents, err = app.documentRepo.Get(map[string]any{"user_id": user.ID, "is_archived": false})
+	return c.JSON(http.StatusOK, echo.Map{})
+}
+
+func (app App) DeleteArchivedDocument(c echo.Context) error {
+	document, err := contextDocument(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
-	for _, ad := range documents {
-		reindexObjects = append(reindexObjects, ad.ToSearchObject())
+		return err
 	}
-	if err := app.sclient.Reindex(app.config.SearchIndex, reindexObjects); err != nil {
+	err = app.documentRepo.Transaction(func(tx data.DocumentRepositoryInterface) error {
+		// the whole deleted subtree leaves the search index
+		affected, err := tx.Delete(document)
+		if err != nil {
+			return err
+		}
+		return tx.EnqueueIndex(data.IndexDelete, affected...)
+	})
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{})
 }
 
-func (app App) DeleteArchivedDocument(c echo.Context) error {
+func (app App) GetArchivedDocuments(c echo.Context) error {
 	var user *clerk.User
-	var document *data.Document
-	var deletedDocuments []data.Document
-	var reindexObjects []map[string]any
+	var documents []data.Document
+	pageData := ListArchivedDocumentsRequest{
+		Sort: "-updatedAt",
+	}
+	v := validator.NewValidator()
 
 	user, ok := c.Get("user").(*clerk.User)
 	if !ok {
 		return echo.ErrUnauthorized
 	}
-	documentID := c.Param("documentID")
-	document, err := app.documentRepo.First(map[string]any{"id": documentID})
-	if err != nil {
-		switch {
-		case errors.Is(err, gorm.ErrRecordNotFound):
-			return echo.NewHTTPError(http.StatusNotFound, err)
-		default:
-			return echo.NewHTTPError(http.StatusInternalServerError, err)
 
-		}
-	}
-	if user.ID != document.UserID {
-		return echo.ErrForbidden
+	if err := c.Bind(&pageData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request data")
 	}
-	if err := app.documentRepo.Delete(document); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	if err := v.ValidateStruct(pageData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
 
-	// reindex all archived documents
-	deletedDocuments, err = app.documentRepo.Get("user_id = ? AND deleted_at IS NOT NULL", user.ID)
+	documents, nextCursor, total, err := app.documentRepo.GetPage(pageData.Page(pageData.Sort), "user_id=? AND is_archived=true", user.ID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
-	for _, ad := range deletedDocuments {
-		reindexObjects = append(reindexObjects, ad.ToSearchObject())
-	}
-	if err := app.sclient.Reindex(app.config.SearchIndex, reindexObjects); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
-
-	return c.JSON(http.StatusOK, echo.Map{})
+	return c.JSON(http.StatusOK, Response[[]data.Document]{
+		Data:       documents,
+		Total:      int(total),
+		NextCursor: nextCursor,
+	})
 }
 
-func (app App) GetArchivedDocuments(c echo.Context) error {
+// Documents the user deleted that are still within the trash retention
+// period. Only the roots of each deletion are listed, their descendants come
+// back along with them.
+func (app App) GetDeletedDocuments(c echo.Context) error {
 	var user *clerk.User
 	var documents []data.Document
+	pageData := ListDeletedDocumentsRequest{
+		Sort: "-deletedAt",
+	}
+	v := validator.NewValidator()
 
 	user, ok := c.Get("user").(*clerk.User)
 	if !ok {
 		return echo.ErrUnauthorized
 	}
 
-	documents, err := app.documentRepo.Get("user_id=? AND is_archived=true", user.ID)
+	if err := c.Bind(&pageData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request data")
+	}
+	if err := v.ValidateStruct(pageData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	documents, nextCursor, total, err := app.documentRepo.Unscoped().GetPage(
+		pageData.Page(pageData.Sort),
+		`user_id = ? AND deleted_at IS NOT NULL AND deleted_at > ?
+		AND NOT EXISTS (SELECT 1 FROM documents parent WHERE parent.id = documents.parent_document_id AND parent.deleted_at = documents.deleted_at)`,
+		user.ID, app.trashCutoff(),
+	)
 	if err != nil {
 		switch {
-		case errors.Is(err, gorm.ErrRecordNotFound):
-			return echo.NewHTTPError(http.StatusNotFound, err)
+		case errors.Is(err, data.ErrInvalidCursor):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		default:
 			return echo.NewHTTPError(http.StatusInternalServerError, err)
 		}
 	}
 	return c.JSON(http.StatusOK, Response[[]data.Document]{
-		Data:  documents,
-		Total: int(len(documents)),
+		Data:       documents,
+		Total:      int(total),
+		NextCursor: nextCursor,
+	})
+}
+
+func (app App) UndeleteDocument(c echo.Context) error {
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+	if !document.DeletedAt.Time.After(app.trashCutoff()) {
+		return echo.NewHTTPError(http.StatusGone, "document is past the trash retention period")
+	}
+	err = app.documentRepo.Transaction(func(tx data.DocumentRepositoryInterface) error {
+		affected, err := tx.Undelete(document)
+		if err != nil {
+			return err
+		}
+		return tx.EnqueueIndex(data.IndexSave, affected...)
 	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, Response[data.Document]{
+		Data: *document,
+	})
+}
+
+// Documents deleted before the cutoff are purged and cannot be undeleted.
+// Zero when the trash is kept forever.
+func (app App) trashCutoff() time.Time {
+	if app.config.TrashRetentionDays == 0 {
+		return time.Time{}
+	}
+	return time.Now().UTC().Add(-purge.NewOptions(app.config).Retention)
 }
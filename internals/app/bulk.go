@@ -0,0 +1,131 @@
+package app
+
+import (
+	"errors"
+	"loshon-api/internals/data"
+	"loshon-api/internals/policy"
+	"loshon-api/internals/validator"
+	"net/http"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Apply many actions over many documents in one database transaction. Every
+// item runs in its own savepoint so one failure does not undo the others, and
+// a single batch of search index updates is queued for everything that changed.
+func (app App) BulkDocuments(c echo.Context) error {
+	var user *clerk.User
+	var results []BulkResult
+	var affected, removed []uuid.UUID
+	bulkData := BulkDocumentsRequest{}
+	v := validator.NewValidator()
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	if err := c.Bind(&bulkData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request object")
+	}
+	if err := v.ValidateStruct(bulkData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	err := app.documentRepo.Transaction(func(tx data.DocumentRepositoryInterface) error {
+		for _, action := range bulkData.Actions {
+			for _, id := range action.IDs {
+				var changed []uuid.UUID
+				err := tx.Transaction(func(item data.DocumentRepositoryInterface) error {
+					var err error
+					changed, err = app.applyBulkAction(item, user, action, id)
+					return err
+				})
+				results = append(results, newBulkResult(action.Action, id, err))
+				switch {
+				case err != nil:
+				case action.Action == "delete":
+					removed = append(removed, changed...)
+				default:
+					affected = append(affected, changed...)
+				}
+			}
+		}
+
+		// one index update for every document that changed, deleted ones
+		// are dropped from the index instead
+		if err := tx.EnqueueIndex(data.IndexSave, affected...); err != nil {
+			return err
+		}
+		return tx.EnqueueIndex(data.IndexDelete, removed...)
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, Response[[]BulkResult]{
+		Data:  results,
+		Total: int(len(results)),
+	})
+}
+
+// Returns the IDs of the documents that changed
+func (app App) applyBulkAction(repo data.DocumentRepositoryInterface, user *clerk.User, action BulkAction, id string) ([]uuid.UUID, error) {
+	// every bulk action changes the structure or visibility of the tree
+	document, err := app.authorizedDocument(repo, user, policy.ActionManage, id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch action.Action {
+	case "archive":
+		return repo.Archive(document)
+	case "restore":
+		return repo.Restore(document)
+	case "delete":
+		return repo.Delete(document)
+	case "move":
+		if err := app.validateParent(repo, user, document.UserID, document.WorkspaceID, document.ID, action.ParentDocumentID); err != nil {
+			return nil, err
+		}
+		return []uuid.UUID{document.ID}, repo.Move(document, action.ParentDocumentID, nil, nil)
+	case "publish", "unpublish":
+		document.IsPublished = action.Action == "publish"
+		return []uuid.UUID{document.ID}, repo.Update(document)
+	default:
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "unknown action")
+	}
+}
+
+func newBulkResult(action string, id string, err error) BulkResult {
+	result := BulkResult{
+		ID:     id,
+		Action: action,
+		Status: http.StatusOK,
+	}
+	var herr *echo.HTTPError
+	var verr *validator.StructValidationErrors
+	switch {
+	case err == nil:
+		return result
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		result.Status = http.StatusNotFound
+	case errors.As(err, &herr):
+		result.Status = herr.Code
+	case errors.As(err, &verr):
+		result.Status = http.StatusBadRequest
+	case errors.Is(err, data.ErrVersionConflict):
+		result.Status = http.StatusPreconditionFailed
+	default:
+		result.Status = http.StatusInternalServerError
+	}
+	result.Error = err.Error()
+	return result
+}
@@ -3,80 +3,182 @@ package app
 import (
 	"errors"
 	"loshon-api/internals/data"
+	"loshon-api/internals/policy"
 	"loshon-api/internals/validator"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
 
 func (app App) GetDocuments(c echo.Context) error {
 	var user (*clerk.User)
-	var parentDocument interface{}
 	var documents []data.Document
+	listData := ListDocumentsRequest{
+		Sort: "position",
+	}
+	v := validator.NewValidator()
 
 	user, ok := c.Get("user").(*clerk.User)
 	if !ok {
 		return echo.ErrUnauthorized
 	}
-	if parentId := c.QueryParam("parentDocument"); parentId != "" {
-		parentDocument = parentId
-	} else {
-		parentDocument = nil
+
+	if err := c.Bind(&listData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request data")
+	}
+	if listData.ParentDocument != nil && *listData.ParentDocument == "" {
+		listData.ParentDocument = nil
+	}
+	if err := v.ValidateStruct(listData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
 
-	documents, err := app.documentRepo.Get(
-		map[string]interface{}{
-			"user_id":            user.ID,
-			"parent_document_id": parentDocument,
-			"is_archived":        false,
-		},
-	)
+	// children of a page are listed whoever wrote them, for those who may
+	// see its subtree
+	query, args := "user_id = ? AND parent_document_id IS NULL AND is_archived = false", []any{user.ID}
+	if listData.ParentDocument != nil {
+		if _, err := app.authorizedDocument(app.documentRepo, user, policy.ActionViewTree, *listData.ParentDocument); err != nil {
+			return err
+		}
+		query, args = "parent_document_id = ? AND is_archived = false", []any{*listData.ParentDocument}
+	}
 
+	documents, nextCursor, total, err := app.documentRepo.GetPage(listData.Page(listData.Sort), query, args...)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
 	return c.JSON(http.StatusOK, Response[[]data.Document]{
-		Data:  documents,
-		Total: int(len(documents)),
+		Data:       documents,
+		Total:      int(total),
+		NextCursor: nextCursor,
+	})
+}
+
+func (app App) GetDocumentTree(c echo.Context) error {
+	var user *clerk.User
+	var nodes []data.DocumentTreeNode
+	treeData := DocumentTreeRequest{
+		Depth: 3,
+	}
+	v := validator.NewValidator()
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	if err := c.Bind(&treeData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request data")
+	}
+	if treeData.Root != nil && *treeData.Root == "" {
+		treeData.Root = nil
+	}
+	if err := v.ValidateStruct(treeData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	// the tree holds unpublished descendants, so a published root is not enough
+	if treeData.Root != nil {
+		if _, err := app.authorizedDocument(app.documentRepo, user, policy.ActionViewTree, *treeData.Root); err != nil {
+			return err
+		}
+	}
+
+	nodes, err := app.documentRepo.Tree(user.ID, treeData.Root, treeData.Depth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[[]data.DocumentTreeNode]{
+		Data:  nodes,
+		Total: int(len(nodes)),
 	})
 }
 
 func (app App) GetDocumentByID(c echo.Context) error {
 	var user (*clerk.User)
 	var document *data.Document
+	var ancestors []data.Document
 
-	documentID := c.Param("documentID")
-	document, err := app.documentRepo.First("id = ?", documentID)
+	document, err := contextDocument(c)
 	if err != nil {
-		switch {
-		case errors.Is(err, gorm.ErrRecordNotFound):
-			return echo.NewHTTPError(http.StatusNotFound, err)
-		default:
+		return err
+	}
+	user, _ = c.Get("user").(*clerk.User)
+
+	if c.QueryParam("include") == "ancestors" {
+		ancestors, err = app.visibleAncestors(user, document)
+		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err)
 		}
 	}
-	if document.IsPublished && !document.IsArchived {
-		return c.JSON(http.StatusOK, Response[data.Document]{
+
+	setETag(c, document)
+	return c.JSON(http.StatusOK, DocumentResponse{
+		Response: Response[data.Document]{
 			Data: *document,
-		})
-	}
+		},
+		Ancestors: ancestors,
+	})
+}
 
-	user, ok := c.Get("user").(*clerk.User)
-	if !ok {
-		return echo.ErrUnauthorized
-	}
+func (app App) GetDocumentAncestors(c echo.Context) error {
+	var user (*clerk.User)
+	var document *data.Document
+	var ancestors []data.Document
 
-	if document.UserID != user.ID {
-		return echo.ErrForbidden
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
 	}
+	user, _ = c.Get("user").(*clerk.User)
 
-	return c.JSON(http.StatusOK, Response[data.Document]{
-		Data: *document,
+	ancestors, err = app.visibleAncestors(user, document)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[[]data.Document]{
+		Data:  ancestors,
+		Total: int(len(ancestors)),
 	})
 }
 
+// Ancestors of document from the root down, minus the ones user may not see
+func (app App) visibleAncestors(user *clerk.User, document *data.Document) ([]data.Document, error) {
+	ancestors, err := app.documentRepo.Ancestors(document)
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]data.Document, 0, len(ancestors))
+	for _, ancestor := range ancestors {
+		allowed, err := app.policy.Can(user, policy.ActionView, &ancestor)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			visible = append(visible, ancestor)
+		}
+	}
+	return visible, nil
+}
+
 func (app App) CreateDocument(c echo.Context) error {
 	var user *clerk.User
 	createData := CreateDocumentRequest{}
@@ -99,21 +201,100 @@ func (app App) CreateDocument(c echo.Context) error {
 		}
 	}
 
+	if err := app.validateParent(app.documentRepo, user, user.ID, nil, uuid.Nil, createData.ParentDocumentID); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	workspaceID, err := app.newDocumentWorkspace(user, createData.ParentDocumentID, createData.WorkspaceID)
+	if err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
 	document := data.Document{
 		Title:            createData.Title,
 		UserID:           user.ID,
+		WorkspaceID:      workspaceID,
 		IsArchived:       createData.IsArchived,
 		IsPublished:      createData.IsPublished,
 		ParentDocumentID: createData.ParentDocumentID,
 		Content:          createData.Content,
+		MdContent:        createData.MdContent,
 		CoverImage:       createData.CoverImage,
 		Icon:             createData.Icon,
 	}
-	err := app.documentRepo.Save(&document)
+	position, err := app.documentRepo.NextPosition(user.ID, createData.ParentDocumentID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	document.Position = position
+
+	if createData.TemplateID == nil {
+		err = app.documentRepo.Transaction(func(tx data.DocumentRepositoryInterface) error {
+			if err := tx.Save(&document); err != nil {
+				return err
+			}
+			return tx.EnqueueIndex(data.IndexSave, document.ID)
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+		app.recordRevision(&document, user)
+		setETag(c, &document)
+		return c.JSON(http.StatusOK, Response[data.Document]{
+			Data: document,
+		})
+	}
+
+	template, err := app.findTemplate(user, *createData.TemplateID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return validator.NewStructValidationErrors(
+				validator.NewFieldError("templateId", "exists", "", *createData.TemplateID),
+			).TranslateToHttpError()
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	// the template only fills what the request left out
+	seed := template.Page.NewDocument(user.ID)
+	if document.Content == nil {
+		document.Content = seed.Content
+	}
+	if document.MdContent == nil {
+		document.MdContent = seed.MdContent
+	}
+	if document.Icon == nil {
+		document.Icon = seed.Icon
+	}
+	if document.CoverImage == nil {
+		document.CoverImage = seed.CoverImage
+	}
+
+	var created []data.Document
+	err = app.documentRepo.Transaction(func(tx data.DocumentRepositoryInterface) error {
+		var err error
+		if created, err = tx.CreateFromTemplate(&document, template.Page.Children); err != nil {
+			return err
+		}
+		return tx.EnqueueIndex(data.IndexSave, documentIDs(created)...)
+	})
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
-	app.sclient.SaveObject(app.config.SearchIndex, document.ToSearchObject())
+	for _, cd := range created {
+		app.recordRevision(&cd, user)
+	}
+
+	setETag(c, &document)
 	return c.JSON(http.StatusOK, Response[data.Document]{
 		Data: document,
 	})
@@ -143,18 +324,35 @@ func (app App) UpdateDocument(c echo.Context) error {
 		}
 	}
 
-	document, err := app.documentRepo.First("id = ?", updateData.ID)
+	document, err := contextDocument(c)
 	if err != nil {
-		switch {
-		case errors.Is(err, gorm.ErrRecordNotFound):
-			return echo.NewHTTPError(http.StatusNotFound, err)
-		default:
-			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
+	}
+	// restructuring and visibility changes stay with the owners
+	if updateData.ParentDocumentID.Defined || updateData.IsPublished.Defined || updateData.IsArchived.Defined {
+		if err := app.authorize(user, policy.ActionManage, document); err != nil {
+			return err
 		}
 	}
-
-	if document.UserID != user.ID {
-		return echo.ErrForbidden
+	if !matchesETag(c.Request().Header.Get("If-Match"), document) {
+		return versionConflict(c, document)
+	}
+	if updateData.ParentDocumentID.Defined {
+		if err := app.validateParent(app.documentRepo, user, document.UserID, document.WorkspaceID, document.ID, updateData.ParentDocumentID.Value); err != nil {
+			if verr, ok := err.(*validator.StructValidationErrors); ok {
+				return verr.TranslateToHttpError()
+			} else {
+				return echo.NewHTTPError(http.StatusInternalServerError, err)
+			}
+		}
+		// a new parent means a new sibling list, append to its end
+		if !equalParent(document.ParentDocumentID, updateData.ParentDocumentID.Value) {
+			position, err := app.documentRepo.NextPosition(document.UserID, updateData.ParentDocumentID.Value)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err)
+			}
+			document.Position = position
+		}
 	}
 
 	// patch attributes
@@ -167,13 +365,231 @@ func (app App) UpdateDocument(c echo.Context) error {
 	document.SetIsPublished(updateData.IsPublished)
 	document.SetIsArchived(updateData.IsArchived)
 
-	if err := app.documentRepo.Save(document); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	err = app.documentRepo.Transaction(func(tx data.DocumentRepositoryInterface) error {
+		if err := tx.RecordBaseline(document); err != nil {
+			return err
+		}
+		if err := tx.Update(document); err != nil {
+			return err
+		}
+		return tx.EnqueueIndex(data.IndexSave, document.ID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrVersionConflict):
+			current, err := app.documentRepo.First("id = ?", document.ID)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err)
+			}
+			return versionConflict(c, current)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
+	app.recordRevision(document, user)
 
-	app.sclient.SaveObject(app.config.SearchIndex, document.ToSearchObject())
+	setETag(c, document)
+	return c.JSON(http.StatusOK, Response[data.Document]{
+		Data: *document,
+	})
+}
 
+func (app App) MoveDocument(c echo.Context) error {
+	var user *clerk.User
+	var document *data.Document
+	moveData := MoveDocumentRequest{}
+	v := validator.NewValidator()
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	if err := c.Bind(&moveData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request object")
+	}
+	if err := v.ValidateStruct(moveData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+
+	if err := app.validateParent(app.documentRepo, user, document.UserID, document.WorkspaceID, document.ID, moveData.ParentDocumentID); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	err = app.documentRepo.Move(document, moveData.ParentDocumentID, moveData.BeforeID, moveData.AfterID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidSibling):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	setETag(c, document)
 	return c.JSON(http.StatusOK, Response[data.Document]{
 		Data: *document,
 	})
 }
+
+func (app App) DuplicateDocument(c echo.Context) error {
+	var user *clerk.User
+	var document *data.Document
+	var copies []data.Document
+	duplicateData := DuplicateDocumentRequest{}
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	if err := c.Bind(&duplicateData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request object")
+	}
+
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+
+	// copies of another user's document go to the personal workspace of the
+	// user, so the original owner gets no say over them
+	workspaceID := document.WorkspaceID
+	if document.UserID != user.ID {
+		workspace, err := app.workspaceRepo.Personal(user.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+		workspaceID = &workspace.ID
+	}
+
+	err = app.documentRepo.Transaction(func(tx data.DocumentRepositoryInterface) error {
+		var err error
+		if copies, err = tx.Duplicate(document, user.ID, workspaceID, duplicateData.IncludeDescendants, " (copy)"); err != nil {
+			return err
+		}
+		return tx.EnqueueIndex(data.IndexSave, documentIDs(copies)...)
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	setETag(c, &copies[0])
+	return c.JSON(http.StatusOK, Response[data.Document]{
+		Data: copies[0],
+	})
+}
+
+// Make sure parentID may hold documentID: it must exist, be neither archived
+// nor deleted, belong to workspaceID when given, and must not be documentID or
+// one of its descendants. It must also belong to ownerID (the owner of
+// documentID), unless it sits in a shared workspace and user may edit it.
+// Violations are reported as *validator.StructValidationErrors.
+func (app App) validateParent(repo data.DocumentRepositoryInterface, user *clerk.User, ownerID string, workspaceID *uuid.UUID, documentID uuid.UUID, parentID *string) error {
+	const field = "parentDocumentId"
+	if parentID == nil {
+		return nil
+	}
+	if err := uuid.Validate(*parentID); err != nil {
+		return validator.NewStructValidationErrors(validator.NewFieldError(field, "uuid", "", *parentID))
+	}
+
+	check, err := repo.CheckParent(documentID, *parentID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !check.Exists:
+		return validator.NewStructValidationErrors(validator.NewFieldError(field, "exists", "", *parentID))
+	case check.IsDeleted:
+		return validator.NewStructValidationErrors(validator.NewFieldError(field, "notdeleted", "", *parentID))
+	case check.IsArchived:
+		return validator.NewStructValidationErrors(validator.NewFieldError(field, "notarchived", "", *parentID))
+	case workspaceID != nil && !equalWorkspace(workspaceID, check.WorkspaceID):
+		return validator.NewStructValidationErrors(validator.NewFieldError(field, "sameworkspace", workspaceID.String(), *parentID))
+	case check.CreatesCycle:
+		return validator.NewStructValidationErrors(validator.NewFieldError(field, "nocycle", documentID.String(), *parentID))
+	}
+
+	if check.UserID == ownerID {
+		return nil
+	}
+	// a new document takes the workspace of its parent, an existing one must
+	// already be there
+	if check.IsSharedWorkspace && (documentID == uuid.Nil || equalWorkspace(workspaceID, check.WorkspaceID)) {
+		parent, err := repo.First("id = ?", *parentID)
+		if err != nil {
+			return err
+		}
+		allowed, err := app.policy.Can(user, policy.ActionEdit, parent)
+		if err != nil || allowed {
+			return err
+		}
+	}
+	return validator.NewStructValidationErrors(validator.NewFieldError(field, "owned", "", *parentID))
+}
+
+func equalWorkspace(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalParent(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func documentIDs(documents []data.Document) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(documents))
+	for _, doc := range documents {
+		ids = append(ids, doc.ID)
+	}
+	return ids
+}
+
+func setETag(c echo.Context, document *data.Document) {
+	c.Response().Header().Set("ETag", strconv.Quote(strconv.FormatInt(document.Version, 10)))
+}
+
+// Check an If-Match header against the document version. A missing header
+// or "*" matches anything; otherwise any listed tag must equal the version.
+func matchesETag(ifMatch string, document *data.Document) bool {
+	if ifMatch == "" {
+		return true
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" {
+			return true
+		}
+		if version, err := strconv.ParseInt(strings.Trim(tag, `"`), 10, 64); err == nil && version == document.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// Reply 412 with the current server copy so the client can merge and retry
+func versionConflict(c echo.Context, current *data.Document) error {
+	setETag(c, current)
+	return c.JSON(http.StatusPreconditionFailed, Response[data.Document]{
+		Data: *current,
+	})
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"errors"
+	"loshon-api/internals/data"
+	"loshon-api/internals/policy"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Gives the same role on every document
+type fixedRoles data.Role
+
+func (role fixedRoles) Role(doc *data.Document, userID string) (data.Role, error) {
+	return data.Role(role), nil
+}
+
+// Serves a single document and records whether its tree was loaded
+type singleDocumentRepo struct {
+	data.DocumentRepositoryInterface
+	document   data.Document
+	treeLoaded *bool
+}
+
+func (repo singleDocumentRepo) First(query interface{}, args ...any) (*data.Document, error) {
+	document := repo.document
+	return &document, nil
+}
+
+func (repo singleDocumentRepo) Tree(userID string, rootID *string, depth int) ([]data.DocumentTreeNode, error) {
+	*repo.treeLoaded = true
+	return []data.DocumentTreeNode{}, nil
+}
+
+func TestGetDocumentTreeRoot(t *testing.T) {
+	published := data.Document{ID: uuid.New(), UserID: "user_2", IsPublished: true}
+
+	tests := []struct {
+		name string
+		role data.Role
+		want int
+	}{
+		{"stranger on a published root", data.RoleNone, http.StatusForbidden},
+		{"viewer", data.RoleViewer, http.StatusOK},
+		{"owner", data.RoleOwner, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			treeLoaded := false
+			app := App{
+				documentRepo: singleDocumentRepo{document: published, treeLoaded: &treeLoaded},
+				policy:       policy.New(fixedRoles(test.role)),
+			}
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/api/documents/_tree?root="+published.ID.String(), nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &clerk.User{ID: "user_1"})
+
+			status := http.StatusOK
+			if err := app.GetDocumentTree(c); err != nil {
+				var herr *echo.HTTPError
+				if !errors.As(err, &herr) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				status = herr.Code
+			}
+			if status != test.want {
+				t.Errorf("status = %d, want %d", status, test.want)
+			}
+			if treeLoaded != (test.want == http.StatusOK) {
+				t.Errorf("tree loaded = %v", treeLoaded)
+			}
+		})
+	}
+}
+
+func TestMatchesETag(t *testing.T) {
+	document := &data.Document{Version: 7}
+
+	tests := []struct {
+		ifMatch string
+		want    bool
+	}{
+		{"", true},
+		{"*", true},
+		{`"7"`, true},
+		{`"6"`, false},
+		{`"70"`, false},
+		{`W/"7"`, true},
+		{`"5", "7"`, true},
+		{`"5","6"`, false},
+		{`"5", *`, true},
+		{`"seven"`, false},
+		{`""`, false},
+	}
+	for _, test := range tests {
+		if got := matchesETag(test.ifMatch, document); got != test.want {
+			t.Errorf("matchesETag(%q) = %v, want %v", test.ifMatch, got, test.want)
+		}
+	}
+}
+
+func TestSetETagRoundTrip(t *testing.T) {
+	document := &data.Document{Version: 42}
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	setETag(c, document)
+
+	etag := c.Response().Header().Get("ETag")
+	if etag != `"42"` {
+		t.Fatalf("ETag = %s, want \"42\"", etag)
+	}
+	if !matchesETag(etag, document) {
+		t.Errorf("matchesETag(%s) = false for the version it was made from", etag)
+	}
+	document.Version++
+	if matchesETag(etag, document) {
+		t.Errorf("matchesETag(%s) = true after the version changed", etag)
+	}
+}
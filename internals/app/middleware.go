@@ -1,25 +1,29 @@
 package app
 
 import (
+	"errors"
+	"log/slog"
+	"loshon-api/internals/data"
+	"loshon-api/internals/policy"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/clerk/clerk-sdk-go/v2"
 	"github.com/clerk/clerk-sdk-go/v2/jwt"
 	"github.com/clerk/clerk-sdk-go/v2/user"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 func (app App) ClerkAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		sessionToken := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
-		claims, err := jwt.Verify(c.Request().Context(), &jwt.VerifyParams{
-			Token: sessionToken,
-		})
-		if err != nil {
-			return echo.NewHTTPError(http.StatusUnauthorized, err)
-		}
-		usr, err := user.Get(c.Request().Context(), claims.Subject)
+		usr, err := app.authenticate(c)
 		if err != nil {
+			if herr, ok := err.(*echo.HTTPError); ok {
+				return herr
+			}
 			return echo.NewHTTPError(http.StatusUnauthorized, err)
 		}
 		c.Set("user", usr)
@@ -29,14 +33,7 @@ func (app App) ClerkAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 
 func (app App) OptionalClerkAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		sessionToken := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
-		claims, err := jwt.Verify(c.Request().Context(), &jwt.VerifyParams{
-			Token: sessionToken,
-		})
-		if err != nil {
-			return next(c)
-		}
-		usr, err := user.Get(c.Request().Context(), claims.Subject)
+		usr, err := app.authenticate(c)
 		if err != nil {
 			return next(c)
 		}
@@ -44,3 +41,236 @@ func (app App) OptionalClerkAuthMiddleware(next echo.HandlerFunc) echo.HandlerFu
 		return next(c)
 	}
 }
+
+// Resolve the user behind the Authorization header, which holds either a
+// Clerk session JWT or a personal access token
+func (app App) authenticate(c echo.Context) (*clerk.User, error) {
+	bearer := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+	if strings.HasPrefix(bearer, data.APITokenPrefix) {
+		return app.authenticateAPIToken(c, bearer)
+	}
+
+	claims, err := jwt.Verify(c.Request().Context(), &jwt.VerifyParams{
+		Token: bearer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	usr, err := user.Get(c.Request().Context(), claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if app.config.ClerkOrganizationsEnabled && claims.ActiveOrganizationID != "" {
+		if err := app.syncOrganization(claims, usr.ID); err != nil {
+			slog.Warn("error syncing organization workspace",
+				slog.String("organizationID", claims.ActiveOrganizationID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	return usr, nil
+}
+
+// The token is stored in the context under "apiToken"
+func (app App) authenticateAPIToken(c echo.Context, bearer string) (*clerk.User, error) {
+	token, err := app.apiTokenRepo.FirstByToken(bearer)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid api token")
+		default:
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	if !token.Allows(c.Request().Method) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "api token is read only")
+	}
+
+	usr, err := user.Get(c.Request().Context(), token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.apiTokenRepo.Touch(token); err != nil {
+		slog.Warn("error touching api token",
+			slog.String("tokenID", token.ID.String()),
+			slog.String("error", err.Error()),
+		)
+	}
+	c.Set("apiToken", token)
+	return usr, nil
+}
+
+// Load the document named by the :documentID route parameter, make sure the
+// user, or the share link sent along, may perform action on it and store it
+// in the context for the handler (see contextDocument). Goes after one of the
+// Clerk middlewares.
+func (app App) DocumentPolicyMiddleware(action policy.Action) echo.MiddlewareFunc {
+	return app.documentPolicy(app.documentRepo, "id = ?", action)
+}
+
+// Like DocumentPolicyMiddleware, for the documents in the trash
+func (app App) DeletedDocumentPolicyMiddleware(action policy.Action) echo.MiddlewareFunc {
+	return app.documentPolicy(app.documentRepo.Unscoped(), "id = ? AND deleted_at IS NOT NULL", action)
+}
+
+func (app App) documentPolicy(repo data.DocumentRepositoryInterface, query string, action policy.Action) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			document, err := findDocument(repo, query, c.Param("documentID"))
+			if err != nil {
+				return err
+			}
+
+			user, _ := c.Get("user").(*clerk.User)
+			err = app.authorize(user, action, document)
+			// a share link sent along may grant what the user lacks
+			if token := c.Request().Header.Get(headerShareToken); err != nil && token != "" {
+				err = app.authorizeShareLink(c, token, action, document)
+			}
+			if err != nil {
+				return err
+			}
+			c.Set("document", document)
+			return next(c)
+		}
+	}
+}
+
+// Load documentID and check that user may perform action on it, for the
+// handlers that get document IDs from the request body or query rather than
+// the route
+func (app App) authorizedDocument(repo data.DocumentRepositoryInterface, user *clerk.User, action policy.Action, documentID string) (*data.Document, error) {
+	document, err := findDocument(repo, "id = ?", documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.authorize(user, action, document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// First document matching query for documentID. Malformed and unknown IDs
+// are both reported as 404.
+func findDocument(repo data.DocumentRepositoryInterface, query string, documentID string) (*data.Document, error) {
+	if err := uuid.Validate(documentID); err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "document not found")
+	}
+	document, err := repo.First(query, documentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, echo.NewHTTPError(http.StatusNotFound, "document not found")
+		default:
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	return document, nil
+}
+
+// Document loaded by DocumentPolicyMiddleware
+func contextDocument(c echo.Context) (*data.Document, error) {
+	document, ok := c.Get("document").(*data.Document)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "invalid context")
+	}
+	return document, nil
+}
+
+// Check that user may perform action on document. user is nil for anonymous
+// requests, which are asked to authenticate rather than forbidden.
+func (app App) authorize(user *clerk.User, action policy.Action, document *data.Document) error {
+	allowed, err := app.policy.Can(user, action, document)
+	switch {
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	case allowed:
+		return nil
+	case user == nil:
+		return echo.ErrUnauthorized
+	default:
+		return echo.ErrForbidden
+	}
+}
+
+// Load the workspace named by the :workspaceID route parameter along with the
+// membership of the user, who must hold at least role in it. Both are stored
+// in the context (see contextWorkspace). Goes after ClerkAuthMiddleware.
+func (app App) WorkspaceMiddleware(role data.WorkspaceRole) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, ok := c.Get("user").(*clerk.User)
+			if !ok {
+				return echo.ErrUnauthorized
+			}
+			workspaceID := c.Param("workspaceID")
+			if err := uuid.Validate(workspaceID); err != nil {
+				return echo.NewHTTPError(http.StatusNotFound, "workspace not found")
+			}
+			workspace, err := app.workspaceRepo.First(workspaceID)
+			if err != nil {
+				switch {
+				case errors.Is(err, gorm.ErrRecordNotFound):
+					return echo.NewHTTPError(http.StatusNotFound, "workspace not found")
+				default:
+					return echo.NewHTTPError(http.StatusInternalServerError, err)
+				}
+			}
+
+			membership, err := app.workspaceRepo.Member(workspace.ID, user.ID)
+			if err != nil {
+				switch {
+				case errors.Is(err, gorm.ErrRecordNotFound):
+					return echo.ErrForbidden
+				default:
+					return echo.NewHTTPError(http.StatusInternalServerError, err)
+				}
+			}
+			if !membership.Role.Includes(role) {
+				return echo.ErrForbidden
+			}
+			c.Set("workspace", workspace)
+			c.Set("membership", membership)
+			return next(c)
+		}
+	}
+}
+
+// Workspace loaded by WorkspaceMiddleware
+func contextWorkspace(c echo.Context) (*data.Workspace, error) {
+	workspace, ok := c.Get("workspace").(*data.Workspace)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "invalid context")
+	}
+	return workspace, nil
+}
+
+// Mirror the active Clerk organization of the session as a workspace, with
+// the user as a member whose role follows their organization role. The
+// membership is renewed once half of its lifetime is gone, so it lapses soon
+// after the user leaves the organization and stops getting its claims.
+func (app App) syncOrganization(claims *clerk.SessionClaims, userID string) error {
+	name := claims.ActiveOrganizationSlug
+	if name == "" {
+		name = claims.ActiveOrganizationID
+	}
+	workspace, err := app.workspaceRepo.Organization(claims.ActiveOrganizationID, name)
+	if err != nil {
+		return err
+	}
+
+	role := data.WorkspaceMember
+	if claims.ActiveOrganizationRole == "org:admin" {
+		role = data.WorkspaceAdmin
+	}
+	ttl := organizationMembershipTTL(app.config)
+	membership, err := app.workspaceRepo.Member(workspace.ID, userID)
+	switch {
+	case err == nil && membership.Role == role && membership.ExpiresAt != nil && time.Until(*membership.ExpiresAt) > ttl/2:
+		return nil
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+	_, err = app.workspaceRepo.Sync(workspace.ID, userID, role, time.Now().Add(ttl))
+	return err
+}
@@ -0,0 +1,24 @@
+package app
+
+import (
+	"loshon-api/internals/config"
+	"loshon-api/internals/data"
+	"time"
+)
+
+// Settings of the packages the app wires together, built from the plain
+// config fields so config does not depend on them
+
+func revisionRetention(config *config.AppConfig) data.RevisionRetention {
+	return data.RevisionRetention{
+		MaxCount:       config.RevisionMaxCount,
+		MaxAge:         time.Duration(config.RevisionMaxAgeDays) * 24 * time.Hour,
+		CoalesceWindow: time.Duration(config.RevisionCoalesceSeconds) * time.Second,
+	}
+}
+
+// How long a workspace membership mirrored from a Clerk organization lasts
+// without a session of the member renewing it
+func organizationMembershipTTL(config *config.AppConfig) time.Duration {
+	return time.Duration(config.ClerkOrganizationMembershipHours) * time.Hour
+}
@@ -1,11 +1,59 @@
 package app
 
-import "loshon-api/internals/data"
+import (
+	"loshon-api/internals/data"
+	"time"
+)
 
 type Response[T any] struct {
-	Data  T   `json:"data"`
-	Page  int `json:"page,omitempty"`
-	Total int `json:"total,omitempty"`
+	Data       T      `json:"data"`
+	Page       int    `json:"page,omitempty"`
+	Total      int    `json:"total,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// Listings stay whole unless a limit or a cursor is sent, so clients that do
+// not paginate keep getting every document. Each listing adds the Sort it
+// supports.
+type PageRequest struct {
+	Limit  int    `json:"limit" query:"limit" validate:"omitempty,min=1,max=500"`
+	Cursor string `json:"cursor" query:"cursor"`
+}
+
+const defaultPageLimit = 100
+
+func (req PageRequest) Page(sort string) data.Page {
+	limit := req.Limit
+	if limit == 0 && req.Cursor != "" {
+		limit = defaultPageLimit
+	}
+	return data.Page{
+		Limit:  limit,
+		Cursor: req.Cursor,
+		Sort:   sort,
+	}
+}
+
+type ListDocumentsRequest struct {
+	PageRequest
+	Sort           string  `json:"sort" query:"sort" validate:"oneof=title -title createdAt -createdAt updatedAt -updatedAt position -position"`
+	ParentDocument *string `json:"parentDocument" query:"parentDocument" validate:"omitempty,uuid"`
+}
+
+type ListArchivedDocumentsRequest struct {
+	PageRequest
+	Sort string `json:"sort" query:"sort" validate:"oneof=title -title createdAt -createdAt updatedAt -updatedAt position -position"`
+}
+
+// The trash can also be sorted by deletion time, which other listings lack
+type ListDeletedDocumentsRequest struct {
+	PageRequest
+	Sort string `json:"sort" query:"sort" validate:"oneof=title -title createdAt -createdAt updatedAt -updatedAt deletedAt -deletedAt"`
+}
+
+type DocumentResponse struct {
+	Response[data.Document]
+	Ancestors []data.Document `json:"ancestors,omitempty"`
 }
 
 type CreateDocumentRequest struct {
@@ -17,6 +65,8 @@ type CreateDocumentRequest struct {
 	MdContent        *string `json:"mdContent"`
 	CoverImage       *string `json:"coverImage"`
 	Icon             *string `json:"icon"`
+	TemplateID       *string `json:"templateId"`
+	WorkspaceID      *string `json:"workspaceId" validate:"omitempty,uuid"`
 }
 
 type UpdateDocumentRequest struct {
@@ -30,3 +80,88 @@ type UpdateDocumentRequest struct {
 	CoverImage       data.Optional[string] `json:"coverImage"`
 	Icon             data.Optional[string] `json:"icon"`
 }
+
+type MoveDocumentRequest struct {
+	ParentDocumentID *string `json:"parentDocumentId" validate:"omitempty,uuid"`
+	BeforeID         *string `json:"beforeId" validate:"omitempty,uuid,excluded_with=AfterID"`
+	AfterID          *string `json:"afterId" validate:"omitempty,uuid"`
+}
+
+type DocumentTreeRequest struct {
+	Root  *string `json:"root" query:"root" validate:"omitempty,uuid"`
+	Depth int     `json:"depth" query:"depth" validate:"min=1,max=10"`
+}
+
+type DuplicateDocumentRequest struct {
+	IncludeDescendants bool `json:"includeDescendants"`
+}
+
+type CreateTemplateRequest struct {
+	DocumentID         string `json:"documentId" validate:"required,uuid"`
+	Name               string `json:"name" validate:"required,min=2"`
+	Description        string `json:"description"`
+	IncludeDescendants bool   `json:"includeDescendants"`
+}
+
+type BulkDocumentsRequest struct {
+	Actions []BulkAction `json:"actions" validate:"required,min=1,max=50,dive"`
+}
+
+type BulkAction struct {
+	Action           string   `json:"action" validate:"required,oneof=archive restore delete move publish unpublish"`
+	IDs              []string `json:"ids" validate:"required,min=1,max=100,dive,uuid"`
+	ParentDocumentID *string  `json:"parentDocumentId" validate:"omitempty,uuid"` // move only, nil moves to the top level
+}
+
+type BulkResult struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type SearchRequest struct {
+	Q               string `json:"q" query:"q" validate:"required,max=256"`
+	IncludeArchived bool   `json:"includeArchived" query:"includeArchived"`
+	Limit           int    `json:"limit" query:"limit" validate:"min=1,max=100"`
+}
+
+type GrantPermissionRequest struct {
+	UserID string    `json:"userId" validate:"required"`
+	Role   data.Role `json:"role" validate:"required,oneof=viewer commenter editor owner"`
+}
+
+type CreateShareLinkRequest struct {
+	Role               data.Role  `json:"role" validate:"required,oneof=viewer commenter editor"`
+	Password           *string    `json:"password" validate:"omitempty,min=8,max=72"`
+	ExpiresAt          *time.Time `json:"expiresAt"`
+	IncludeDescendants bool       `json:"includeDescendants"`
+}
+
+// documentId opens a descendant of the shared document, depth is how deep
+// its children are listed
+type SharedDocumentRequest struct {
+	DocumentID string `query:"documentId"`
+	Depth      int    `query:"depth" validate:"min=1,max=10"`
+}
+
+type SharedDocumentResponse struct {
+	Response[data.Document]
+	Role     data.Role               `json:"role"`
+	Children []data.DocumentTreeNode `json:"children,omitempty"`
+}
+
+type CreateWorkspaceRequest struct {
+	Name string `json:"name" validate:"required,min=2,max=100"`
+}
+
+type AddWorkspaceMemberRequest struct {
+	UserID string             `json:"userId" validate:"required"`
+	Role   data.WorkspaceRole `json:"role" validate:"required,oneof=owner admin member"`
+}
+
+type CreateAPITokenRequest struct {
+	Name      string          `json:"name" validate:"required,min=2,max=100"`
+	Scope     data.TokenScope `json:"scope" validate:"required,oneof=read write"`
+	ExpiresAt *time.Time      `json:"expiresAt"`
+}
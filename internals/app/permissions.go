@@ -0,0 +1,124 @@
+package app
+
+import (
+	"errors"
+	"loshon-api/internals/data"
+	"loshon-api/internals/policy"
+	"loshon-api/internals/validator"
+	"net/http"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	clerkuser "github.com/clerk/clerk-sdk-go/v2/user"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Collaborators of the document, including the ones invited on an ancestor
+func (app App) GetDocumentPermissions(c echo.Context) error {
+	var document *data.Document
+	var permissions []data.DocumentPermission
+
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+
+	permissions, err = app.permissionRepo.Get(document)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[[]data.DocumentPermission]{
+		Data:  permissions,
+		Total: int(len(permissions)),
+	})
+}
+
+// Invite a collaborator, or change the role of one already invited
+func (app App) GrantDocumentPermission(c echo.Context) error {
+	var user *clerk.User
+	var document *data.Document
+	grantData := GrantPermissionRequest{}
+	v := validator.NewValidator()
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	if err := c.Bind(&grantData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request object")
+	}
+	if err := v.ValidateStruct(grantData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+
+	if grantData.UserID == document.UserID {
+		return validator.NewStructValidationErrors(
+			validator.NewFieldError("userId", "notowner", "", grantData.UserID),
+		).TranslateToHttpError()
+	}
+	if _, err := clerkuser.Get(c.Request().Context(), grantData.UserID); err != nil {
+		var aerr *clerk.APIErrorResponse
+		if errors.As(err, &aerr) && aerr.HTTPStatusCode == http.StatusNotFound {
+			return validator.NewStructValidationErrors(
+				validator.NewFieldError("userId", "exists", "", grantData.UserID),
+			).TranslateToHttpError()
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	permission := data.DocumentPermission{
+		DocumentID: document.ID,
+		UserID:     grantData.UserID,
+		Role:       grantData.Role,
+		GrantedBy:  &user.ID,
+	}
+	if err := app.permissionRepo.Grant(&permission); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[data.DocumentPermission]{
+		Data: permission,
+	})
+}
+
+// Owners may revoke anyone, collaborators may remove themselves. Only
+// permissions granted on this very document can be revoked here.
+func (app App) RevokeDocumentPermission(c echo.Context) error {
+	var user *clerk.User
+	var document *data.Document
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+	userID := c.Param("userID")
+	if userID != user.ID {
+		if err := app.authorize(user, policy.ActionManage, document); err != nil {
+			return err
+		}
+	}
+
+	if err := app.permissionRepo.Revoke(document.ID, userID); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	return c.JSON(http.StatusOK, echo.Map{})
+}
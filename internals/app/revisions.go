@@ -0,0 +1,124 @@
+package app
+
+import (
+	"errors"
+	"log/slog"
+	"loshon-api/internals/data"
+	"net/http"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func (app App) GetDocumentRevisions(c echo.Context) error {
+	var document *data.Document
+	var revisions []data.DocumentRevision
+
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+
+	revisions, err = app.revisionRepo.Get(document.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[[]data.DocumentRevision]{
+		Data:  revisions,
+		Total: int(len(revisions)),
+	})
+}
+
+func (app App) GetDocumentRevisionByID(c echo.Context) error {
+	var document *data.Document
+	var revision *data.DocumentRevision
+
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+
+	revision, err = app.revisionRepo.First(document.ID, c.Param("revisionID"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	return c.JSON(http.StatusOK, Response[data.DocumentRevision]{
+		Data: *revision,
+	})
+}
+
+func (app App) RestoreDocumentRevision(c echo.Context) error {
+	var user *clerk.User
+	var document *data.Document
+	var revision *data.DocumentRevision
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+
+	revision, err = app.revisionRepo.First(document.ID, c.Param("revisionID"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	if !matchesETag(c.Request().Header.Get("If-Match"), document) {
+		return versionConflict(c, document)
+	}
+
+	revision.ApplyTo(document)
+	err = app.documentRepo.Transaction(func(tx data.DocumentRepositoryInterface) error {
+		if err := tx.RecordBaseline(document); err != nil {
+			return err
+		}
+		if err := tx.Update(document); err != nil {
+			return err
+		}
+		return tx.EnqueueIndex(data.IndexSave, document.ID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrVersionConflict):
+			current, err := app.documentRepo.First("id = ?", document.ID)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err)
+			}
+			return versionConflict(c, current)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	// the restore itself becomes a revision, so it can be undone
+	app.recordRevision(document, user)
+
+	setETag(c, document)
+	return c.JSON(http.StatusOK, Response[data.Document]{
+		Data: *document,
+	})
+}
+
+// Revision history is best effort, a failure must not fail the save itself
+func (app App) recordRevision(document *data.Document, user *clerk.User) {
+	if _, err := app.revisionRepo.Record(document, user.ID); err != nil {
+		slog.Warn("error recording revision",
+			slog.String("documentID", document.ID.String()),
+			slog.String("error", err.Error()),
+		)
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"loshon-api/internals/search"
+	"loshon-api/internals/validator"
+	"net/http"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/labstack/echo/v4"
+)
+
+func (app App) SearchDocuments(c echo.Context) error {
+	var user *clerk.User
+	var result *search.Result
+	searchData := SearchRequest{
+		Limit: 20,
+	}
+	v := validator.NewValidator()
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	if err := c.Bind(&searchData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request data")
+	}
+	if err := v.ValidateStruct(searchData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	result, err := app.sclient.Search(app.config.SearchIndex, search.Query{
+		Text:            searchData.Q,
+		UserID:          user.ID,
+		IncludeArchived: searchData.IncludeArchived,
+		Limit:           searchData.Limit,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[[]search.Hit]{
+		Data:  result.Hits,
+		Total: result.Total,
+	})
+}
+
+func (app App) GetSearchKey(c echo.Context) error {
+	var user *clerk.User
+	var key *search.SecuredKey
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	issuer, ok := app.sclient.(search.KeyIssuer)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotImplemented, "search keys are not available with this search backend")
+	}
+	ttl := time.Duration(app.config.SearchKeyTTLMinutes) * time.Minute
+	key, err := issuer.SecuredKey(app.config.SearchIndex, user.ID, ttl)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[search.SecuredKey]{
+		Data: *key,
+	})
+}
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"errors"
+	"loshon-api/internals/data"
+	"loshon-api/internals/policy"
+	"loshon-api/internals/validator"
+	"net/http"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	// lets a share link grant access on the regular document routes
+	headerShareToken    = "X-Share-Token"
+	headerSharePassword = "X-Share-Password"
+)
+
+func (app App) CreateShareLink(c echo.Context) error {
+	var user *clerk.User
+	var document *data.Document
+	createData := CreateShareLinkRequest{}
+	v := validator.NewValidator()
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	if err := c.Bind(&createData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request object")
+	}
+	if err := v.ValidateStruct(createData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	if createData.ExpiresAt != nil && !createData.ExpiresAt.After(time.Now()) {
+		return validator.NewStructValidationErrors(
+			validator.NewFieldError("expiresAt", "future", "", createData.ExpiresAt.Format(time.RFC3339)),
+		).TranslateToHttpError()
+	}
+
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+
+	link := data.ShareLink{
+		DocumentID:         document.ID,
+		CreatedBy:          user.ID,
+		Role:               createData.Role,
+		IncludeDescendants: createData.IncludeDescendants,
+		ExpiresAt:          createData.ExpiresAt,
+	}
+	if err := link.GenerateToken(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if createData.Password != nil {
+		if err := link.SetPassword(*createData.Password); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	if err := app.shareLinkRepo.Save(&link); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// the token is only ever returned here
+	return c.JSON(http.StatusOK, Response[data.ShareLink]{
+		Data: link,
+	})
+}
+
+func (app App) GetShareLinks(c echo.Context) error {
+	var document *data.Document
+	var links []data.ShareLink
+
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+
+	links, err = app.shareLinkRepo.Get(document.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[[]data.ShareLink]{
+		Data:  links,
+		Total: int(len(links)),
+	})
+}
+
+func (app App) RevokeShareLink(c echo.Context) error {
+	var document *data.Document
+
+	document, err := contextDocument(c)
+	if err != nil {
+		return err
+	}
+	linkID := c.Param("linkID")
+	if err := uuid.Validate(linkID); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "share link not found")
+	}
+
+	if err := app.shareLinkRepo.Revoke(document.ID, linkID); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "share link not found")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	return c.JSON(http.StatusOK, echo.Map{})
+}
+
+// Open the document of a share link, or with ?documentId one of its
+// descendants when the link covers them. Links that include descendants list
+// its children, ?depth levels deep. Signed in users get the better of the
+// link role and their own.
+func (app App) GetSharedDocument(c echo.Context) error {
+	var user *clerk.User
+	var document *data.Document
+	var children []data.DocumentTreeNode
+	sharedData := SharedDocumentRequest{
+		Depth: 1,
+	}
+	v := validator.NewValidator()
+
+	if err := c.Bind(&sharedData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request data")
+	}
+	if err := v.ValidateStruct(sharedData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	link, err := app.resolveShareLink(c, c.Param("token"))
+	if err != nil {
+		return err
+	}
+
+	documentID := link.DocumentID.String()
+	if sharedData.DocumentID != "" {
+		documentID = sharedData.DocumentID
+	}
+	document, err = findDocument(app.documentRepo, "id = ?", documentID)
+	if err != nil {
+		return err
+	}
+	covered, err := app.shareLinkCovers(link, document)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if !covered || document.IsArchived {
+		return echo.NewHTTPError(http.StatusNotFound, "document not found")
+	}
+
+	role := link.Role
+	user, _ = c.Get("user").(*clerk.User)
+	if user != nil {
+		own, err := app.permissionRepo.Role(document, user.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+		if own.Includes(role) {
+			role = own
+		}
+	}
+
+	if link.IncludeDescendants {
+		children, err = app.documentRepo.Tree(document.UserID, &documentID, sharedData.Depth)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	setETag(c, document)
+	return c.JSON(http.StatusOK, SharedDocumentResponse{
+		Response: Response[data.Document]{
+			Data: *document,
+		},
+		Role:     role,
+		Children: children,
+	})
+}
+
+// Look up the live link of token and check the password sent along with it
+func (app App) resolveShareLink(c echo.Context, token string) (*data.ShareLink, error) {
+	link, err := app.shareLinkRepo.FirstByToken(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, echo.NewHTTPError(http.StatusNotFound, "share link not found")
+		default:
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	if !link.CheckPassword(c.Request().Header.Get(headerSharePassword)) {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "share link password required")
+	}
+	return link, nil
+}
+
+// Whether link reaches document: the document it was created on, or one of
+// its descendants when the link includes them
+func (app App) shareLinkCovers(link *data.ShareLink, document *data.Document) (bool, error) {
+	if link.DocumentID == document.ID {
+		return true, nil
+	}
+	if !link.IncludeDescendants {
+		return false, nil
+	}
+	ancestors, err := app.documentRepo.Ancestors(document)
+	if err != nil {
+		return false, err
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.ID == link.DocumentID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Grant action on document through the share link token sent in the
+// X-Share-Token header
+func (app App) authorizeShareLink(c echo.Context, token string, action policy.Action, document *data.Document) error {
+	link, err := app.resolveShareLink(c, token)
+	if err != nil {
+		return err
+	}
+	covered, err := app.shareLinkCovers(link, document)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if !covered || !policy.AllowsLink(link.Role, action) {
+		return echo.ErrForbidden
+	}
+	// like GetSharedDocument, links stop at archived documents
+	if document.IsArchived {
+		return echo.NewHTTPError(http.StatusNotFound, "document not found")
+	}
+	return nil
+}
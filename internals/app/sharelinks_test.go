@@ -0,0 +1,113 @@
+package app
+
+import (
+	"errors"
+	"loshon-api/internals/data"
+	"loshon-api/internals/policy"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Serves Ancestors from a fixed parent map, any other call panics
+type treeRepo struct {
+	data.DocumentRepositoryInterface
+	parents map[uuid.UUID]uuid.UUID
+}
+
+func (repo treeRepo) Ancestors(doc *data.Document) ([]data.Document, error) {
+	ancestors := []data.Document{}
+	for id, ok := repo.parents[doc.ID]; ok; id, ok = repo.parents[id] {
+		ancestors = append(ancestors, data.Document{ID: id})
+	}
+	return ancestors, nil
+}
+
+func TestShareLinkCovers(t *testing.T) {
+	root, child, grandchild, other := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	app := App{documentRepo: treeRepo{parents: map[uuid.UUID]uuid.UUID{
+		child:      root,
+		grandchild: child,
+	}}}
+
+	tests := []struct {
+		name        string
+		linked      uuid.UUID
+		descendants bool
+		document    uuid.UUID
+		want        bool
+	}{
+		{"linked document", root, false, root, true},
+		{"linked document with descendants", root, true, root, true},
+		{"child without descendants", root, false, child, false},
+		{"child", root, true, child, true},
+		{"grandchild", root, true, grandchild, true},
+		{"ancestor", grandchild, true, root, false},
+		{"sibling tree", other, true, grandchild, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			link := &data.ShareLink{DocumentID: test.linked, IncludeDescendants: test.descendants}
+			covered, err := app.shareLinkCovers(link, &data.Document{ID: test.document})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if covered != test.want {
+				t.Errorf("got %v, want %v", covered, test.want)
+			}
+		})
+	}
+}
+
+// Resolves every token to the same link
+type singleLinkRepo struct {
+	data.ShareLinkRepositoryInterface
+	link data.ShareLink
+}
+
+func (repo singleLinkRepo) FirstByToken(token string) (*data.ShareLink, error) {
+	link := repo.link
+	return &link, nil
+}
+
+func TestAuthorizeShareLink(t *testing.T) {
+	documentID := uuid.New()
+	active := data.Document{ID: documentID}
+	archived := data.Document{ID: documentID, IsArchived: true}
+
+	tests := []struct {
+		name     string
+		role     data.Role
+		action   policy.Action
+		document data.Document
+		want     int
+	}{
+		{"view", data.RoleViewer, policy.ActionView, active, http.StatusOK},
+		{"edit with a viewer link", data.RoleViewer, policy.ActionEdit, active, http.StatusForbidden},
+		{"edit", data.RoleEditor, policy.ActionEdit, active, http.StatusOK},
+		{"history", data.RoleEditor, policy.ActionViewHistory, active, http.StatusForbidden},
+		{"view archived", data.RoleViewer, policy.ActionView, archived, http.StatusNotFound},
+		{"edit archived", data.RoleEditor, policy.ActionEdit, archived, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := App{shareLinkRepo: singleLinkRepo{link: data.ShareLink{DocumentID: documentID, Role: test.role}}}
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+			status := http.StatusOK
+			if err := app.authorizeShareLink(c, "token", test.action, &test.document); err != nil {
+				var herr *echo.HTTPError
+				if !errors.As(err, &herr) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				status = herr.Code
+			}
+			if status != test.want {
+				t.Errorf("status = %d, want %d", status, test.want)
+			}
+		})
+	}
+}
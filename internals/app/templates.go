@@ -0,0 +1,96 @@
+package app
+
+import (
+	"loshon-api/internals/data"
+	"loshon-api/internals/policy"
+	"loshon-api/internals/templates"
+	"loshon-api/internals/validator"
+	"net/http"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func (app App) GetTemplates(c echo.Context) error {
+	var user *clerk.User
+	var userTemplates []data.Template
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	userTemplates, err := app.templateRepo.Get(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	allTemplates := append(templates.BuiltIn(), userTemplates...)
+	return c.JSON(http.StatusOK, Response[[]data.Template]{
+		Data:  allTemplates,
+		Total: int(len(allTemplates)),
+	})
+}
+
+func (app App) CreateTemplate(c echo.Context) error {
+	var user *clerk.User
+	var document *data.Document
+	createData := CreateTemplateRequest{}
+	v := validator.NewValidator()
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	if err := c.Bind(&createData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request data")
+	}
+	if err := v.ValidateStruct(createData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	// the snapshot takes unpublished descendants too, so viewing the published
+	// root is not enough
+	document, err := app.authorizedDocument(app.documentRepo, user, policy.ActionEdit, createData.DocumentID)
+	if err != nil {
+		return err
+	}
+
+	subtree := []data.Document{*document}
+	if createData.IncludeDescendants {
+		subtree, err = app.documentRepo.Subtree(document)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	template := data.Template{
+		UserID:      &user.ID,
+		Name:        createData.Name,
+		Description: createData.Description,
+		Page:        data.NewTemplatePage(*document, subtree),
+	}
+	if err := app.templateRepo.Save(&template); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[data.Template]{
+		Data: template,
+	})
+}
+
+// Resolve a built-in template by its slug, or one of the user's own by ID
+func (app App) findTemplate(user *clerk.User, templateID string) (*data.Template, error) {
+	if template, ok := templates.Find(templateID); ok {
+		return &template, nil
+	}
+	if err := uuid.Validate(templateID); err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return app.templateRepo.First(user.ID, templateID)
+}
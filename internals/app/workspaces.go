@@ -0,0 +1,303 @@
+package app
+
+import (
+	"errors"
+	"loshon-api/internals/data"
+	"loshon-api/internals/validator"
+	"net/http"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	clerkuser "github.com/clerk/clerk-sdk-go/v2/user"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Workspaces of the user, their personal one first
+func (app App) GetWorkspaces(c echo.Context) error {
+	var user *clerk.User
+	var workspaces []data.Workspace
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	// makes sure users who never created a document have one too
+	if _, err := app.workspaceRepo.Personal(user.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	workspaces, err := app.workspaceRepo.Get(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[[]data.Workspace]{
+		Data:  workspaces,
+		Total: int(len(workspaces)),
+	})
+}
+
+func (app App) CreateWorkspace(c echo.Context) error {
+	var user *clerk.User
+	createData := CreateWorkspaceRequest{}
+	v := validator.NewValidator()
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	if err := c.Bind(&createData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request data")
+	}
+	if err := v.ValidateStruct(createData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	workspace := data.Workspace{
+		Name: createData.Name,
+	}
+	if err := app.workspaceRepo.Save(&workspace, user.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[data.Workspace]{
+		Data: workspace,
+	})
+}
+
+func (app App) GetWorkspaceMembers(c echo.Context) error {
+	var workspace *data.Workspace
+	var members []data.WorkspaceMembership
+
+	workspace, err := contextWorkspace(c)
+	if err != nil {
+		return err
+	}
+
+	members, err = app.workspaceRepo.Members(workspace.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[[]data.WorkspaceMembership]{
+		Data:  members,
+		Total: int(len(members)),
+	})
+}
+
+// Add a member, or change the role of an existing one. Only owners may hand
+// out the owner role.
+func (app App) AddWorkspaceMember(c echo.Context) error {
+	var workspace *data.Workspace
+	var membership *data.WorkspaceMembership
+	memberData := AddWorkspaceMemberRequest{}
+	v := validator.NewValidator()
+
+	if err := c.Bind(&memberData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request data")
+	}
+	if err := v.ValidateStruct(memberData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	workspace, err := contextWorkspace(c)
+	if err != nil {
+		return err
+	}
+	if workspace.PersonalOwnerID != nil || workspace.ClerkOrganizationID != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "members of this workspace are managed elsewhere")
+	}
+	if current, _ := c.Get("membership").(*data.WorkspaceMembership); !current.Role.Includes(memberData.Role) {
+		return echo.ErrForbidden
+	}
+	if _, err := clerkuser.Get(c.Request().Context(), memberData.UserID); err != nil {
+		var aerr *clerk.APIErrorResponse
+		if errors.As(err, &aerr) && aerr.HTTPStatusCode == http.StatusNotFound {
+			return validator.NewStructValidationErrors(
+				validator.NewFieldError("userId", "exists", "", memberData.UserID),
+			).TranslateToHttpError()
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	membership, err = app.workspaceRepo.Join(workspace.ID, memberData.UserID, memberData.Role)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, Response[data.WorkspaceMembership]{
+		Data: *membership,
+	})
+}
+
+// Admins remove members, anyone may leave. Owners can only be removed by
+// owners. Members removed from an organization workspace come back with their
+// next session as long as they are still in the Clerk organization.
+func (app App) RemoveWorkspaceMember(c echo.Context) error {
+	var user *clerk.User
+	var workspace *data.Workspace
+
+	user, ok := c.Get("user").(*clerk.User)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	workspace, err := contextWorkspace(c)
+	if err != nil {
+		return err
+	}
+	if workspace.PersonalOwnerID != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "members of this workspace are managed elsewhere")
+	}
+
+	userID := c.Param("userID")
+	member, err := app.workspaceRepo.Member(workspace.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "member not found")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	current, _ := c.Get("membership").(*data.WorkspaceMembership)
+	if userID != user.ID && !(current.Role.Includes(data.WorkspaceAdmin) && current.Role.Includes(member.Role)) {
+		return echo.ErrForbidden
+	}
+
+	if err := app.workspaceRepo.Leave(workspace.ID, userID); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "member not found")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	return c.JSON(http.StatusOK, echo.Map{})
+}
+
+// Like GetDocuments, but across every author of the workspace
+func (app App) GetWorkspaceDocuments(c echo.Context) error {
+	var workspace *data.Workspace
+	var documents []data.Document
+	listData := ListDocumentsRequest{
+		Sort: "position",
+	}
+	v := validator.NewValidator()
+
+	workspace, err := contextWorkspace(c)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Bind(&listData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request data")
+	}
+	if listData.ParentDocument != nil && *listData.ParentDocument == "" {
+		listData.ParentDocument = nil
+	}
+	if err := v.ValidateStruct(listData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	documents, nextCursor, total, err := app.documentRepo.GetPage(
+		listData.Page(listData.Sort),
+		"workspace_id = ? AND parent_document_id IS NOT DISTINCT FROM ? AND is_archived = false",
+		workspace.ID, listData.ParentDocument,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	return c.JSON(http.StatusOK, Response[[]data.Document]{
+		Data:       documents,
+		Total:      int(total),
+		NextCursor: nextCursor,
+	})
+}
+
+// Like GetArchivedDocuments, but across every author of the workspace
+func (app App) GetWorkspaceArchivedDocuments(c echo.Context) error {
+	var workspace *data.Workspace
+	var documents []data.Document
+	pageData := ListArchivedDocumentsRequest{
+		Sort: "-updatedAt",
+	}
+	v := validator.NewValidator()
+
+	workspace, err := contextWorkspace(c)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Bind(&pageData); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request data")
+	}
+	if err := v.ValidateStruct(pageData); err != nil {
+		if verr, ok := err.(*validator.StructValidationErrors); ok {
+			return verr.TranslateToHttpError()
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	documents, nextCursor, total, err := app.documentRepo.GetPage(pageData.Page(pageData.Sort), "workspace_id = ? AND is_archived = true", workspace.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+	return c.JSON(http.StatusOK, Response[[]data.Document]{
+		Data:       documents,
+		Total:      int(total),
+		NextCursor: nextCursor,
+	})
+}
+
+// Workspace of a new document: the one of its parent, else the requested
+// one, which the user must be a member of, else their personal workspace.
+// Violations are reported as *validator.StructValidationErrors.
+func (app App) newDocumentWorkspace(user *clerk.User, parentID, workspaceID *string) (*uuid.UUID, error) {
+	if parentID != nil {
+		parent, err := app.documentRepo.First("id = ?", *parentID)
+		if err != nil {
+			return nil, err
+		}
+		return parent.WorkspaceID, nil
+	}
+	if workspaceID == nil {
+		workspace, err := app.workspaceRepo.Personal(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &workspace.ID, nil
+	}
+
+	id := uuid.MustParse(*workspaceID)
+	if _, err := app.workspaceRepo.Member(id, user.ID); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, validator.NewStructValidationErrors(validator.NewFieldError("workspaceId", "member", "", *workspaceID))
+		default:
+			return nil, err
+		}
+	}
+	return &id, nil
+}
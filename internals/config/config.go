@@ -13,10 +13,36 @@ type AppConfig struct {
 	ClerkPublishableKey string `mapstructure:"CLERK_PUBLISHABLE_KEY" validate:"required"`
 	ClerkSecretKey      string `mapstructure:"CLERK_SECRET_KEY" validate:"required"`
 	PostgresUrl         string `mapstructure:"POSTGRES_URL" validate:"required"`
-	AngoliaAppID        string `mapstructure:"ANGOLIA_APP_ID" validate:"required"`
-	AngoliaAPIKey       string `mapstructure:"ANGOLIA_API_KEY" validate:"required"`
+	SearchBackend       string `mapstructure:"SEARCH_BACKEND" validate:"oneof=algolia postgres"`
+	AngoliaAppID        string `mapstructure:"ANGOLIA_APP_ID" validate:"required_if=SearchBackend algolia"`
+	AngoliaAPIKey       string `mapstructure:"ANGOLIA_API_KEY" validate:"required_if=SearchBackend algolia"`
 	Port                string `mapstructure:"PORT" validate:"required"`
 	SearchIndex         string `validate:"required"`
+
+	// mirror the active Clerk organization of a session as a workspace, its
+	// memberships lapse when no session renews them for that long
+	ClerkOrganizationsEnabled        bool `mapstructure:"CLERK_ORGANIZATIONS_ENABLED"`
+	ClerkOrganizationMembershipHours int  `mapstructure:"CLERK_ORGANIZATION_MEMBERSHIP_HOURS" validate:"min=1"`
+
+	// lifetime of the secured search keys handed to the frontend
+	SearchKeyTTLMinutes int `mapstructure:"SEARCH_KEY_TTL_MINUTES" validate:"min=1"`
+
+	// revision history retention, 0 disables the limit
+	RevisionMaxCount        int `mapstructure:"REVISION_MAX_COUNT" validate:"gte=0"`
+	RevisionMaxAgeDays      int `mapstructure:"REVISION_MAX_AGE_DAYS" validate:"gte=0"`
+	RevisionCoalesceSeconds int `mapstructure:"REVISION_COALESCE_SECONDS" validate:"gte=0"`
+
+	// search outbox draining, the worker can also run standalone (cmd/outbox_worker)
+	OutboxWorkerEnabled bool `mapstructure:"OUTBOX_WORKER_ENABLED"`
+	OutboxBatchSize     int  `mapstructure:"OUTBOX_BATCH_SIZE" validate:"min=1"`
+	OutboxPollSeconds   int  `mapstructure:"OUTBOX_POLL_SECONDS" validate:"min=1"`
+	OutboxMaxAttempts   int  `mapstructure:"OUTBOX_MAX_ATTEMPTS" validate:"min=1"`
+
+	// deleted documents are purged for good after the retention, 0 keeps them forever
+	TrashRetentionDays   int  `mapstructure:"TRASH_RETENTION_DAYS" validate:"gte=0"`
+	PurgeWorkerEnabled   bool `mapstructure:"PURGE_WORKER_ENABLED"`
+	PurgeIntervalMinutes int  `mapstructure:"PURGE_INTERVAL_MINUTES" validate:"min=1"`
+	PurgeBatchSize       int  `mapstructure:"PURGE_BATCH_SIZE" validate:"min=1"`
 }
 
 func loadEnv(env string) (*AppConfig, error) {
@@ -30,6 +56,23 @@ func loadEnv(env string) (*AppConfig, error) {
 
 	viper.AutomaticEnv()
 
+	// optional settings
+	viper.SetDefault("SEARCH_BACKEND", "algolia")
+	viper.SetDefault("CLERK_ORGANIZATIONS_ENABLED", false)
+	viper.SetDefault("CLERK_ORGANIZATION_MEMBERSHIP_HOURS", 24)
+	viper.SetDefault("SEARCH_KEY_TTL_MINUTES", 60)
+	viper.SetDefault("OUTBOX_WORKER_ENABLED", true)
+	viper.SetDefault("OUTBOX_BATCH_SIZE", 100)
+	viper.SetDefault("OUTBOX_POLL_SECONDS", 2)
+	viper.SetDefault("OUTBOX_MAX_ATTEMPTS", 10)
+	viper.SetDefault("REVISION_MAX_COUNT", 50)
+	viper.SetDefault("REVISION_MAX_AGE_DAYS", 0)
+	viper.SetDefault("REVISION_COALESCE_SECONDS", 60)
+	viper.SetDefault("TRASH_RETENTION_DAYS", 30)
+	viper.SetDefault("PURGE_WORKER_ENABLED", true)
+	viper.SetDefault("PURGE_INTERVAL_MINUTES", 60)
+	viper.SetDefault("PURGE_BATCH_SIZE", 500)
+
 	if err := viper.ReadInConfig(); err != nil {
 		log.Fatalf("failed to load config %v", err)
 	}
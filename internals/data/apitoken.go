@@ -0,0 +1,129 @@
+package data
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Tells personal access tokens apart from Clerk session JWTs
+const APITokenPrefix = "lsh_"
+
+type TokenScope string
+
+const (
+	TokenScopeRead  TokenScope = "read"
+	TokenScopeWrite TokenScope = "write"
+)
+
+// How often LastUsedAt is refreshed at most
+const tokenTouchInterval = time.Minute
+
+// TYPEDEF APITokens
+// A personal access token acting on behalf of UserID
+type APIToken struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid()" json:"id"`
+	UserID     string     `json:"userId"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Token      string     `gorm:"-" json:"token,omitempty"`
+	Scope      TokenScope `json:"scope"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+func (token *APIToken) GenerateToken() error {
+	value, hash, err := newToken(APITokenPrefix)
+	if err != nil {
+		return err
+	}
+	token.Token, token.TokenHash = value, hash
+	return nil
+}
+
+// Read tokens only allow safe methods
+func (token APIToken) Allows(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return token.Scope == TokenScopeWrite
+	}
+}
+
+// API TOKEN MODEL AND IMPLEMENTATION
+type APITokenRepositoryInterface interface {
+	Save(*APIToken) error
+	Get(userID string) ([]APIToken, error)
+	FirstByToken(token string) (*APIToken, error)
+	Touch(*APIToken) error
+	Revoke(userID string, tokenID string) error
+}
+
+type APITokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAPITokenRepository(db *gorm.DB) APITokenRepository {
+	return APITokenRepository{
+		db: db,
+	}
+}
+
+func (repo APITokenRepository) Save(token *APIToken) error {
+	if err := repo.db.Save(token).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// Expired tokens are listed until revoked
+func (repo APITokenRepository) Get(userID string) ([]APIToken, error) {
+	tokens := make([]APIToken, 0)
+	err := repo.db.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at asc").
+		Find(&tokens).Error
+	if err != nil {
+		return tokens, err
+	}
+	return tokens, nil
+}
+
+func (repo APITokenRepository) FirstByToken(value string) (*APIToken, error) {
+	var token APIToken
+	if err := liveToken(repo.db, value).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (repo APITokenRepository) Touch(token *APIToken) error {
+	now := repo.db.NowFunc()
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < tokenTouchInterval {
+		return nil
+	}
+	token.LastUsedAt = &now
+	return repo.db.Model(&APIToken{}).Where("id = ?", token.ID).UpdateColumn("last_used_at", now).Error
+}
+
+func (repo APITokenRepository) Revoke(userID string, tokenID string) error {
+	result := repo.db.Model(&APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", repo.db.NowFunc())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package data
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAPITokenAllows(t *testing.T) {
+	tests := []struct {
+		scope  TokenScope
+		method string
+		want   bool
+	}{
+		{TokenScopeRead, http.MethodGet, true},
+		{TokenScopeRead, http.MethodHead, true},
+		{TokenScopeRead, http.MethodOptions, true},
+		{TokenScopeRead, http.MethodPost, false},
+		{TokenScopeRead, http.MethodPatch, false},
+		{TokenScopeRead, http.MethodPut, false},
+		{TokenScopeRead, http.MethodDelete, false},
+		{TokenScopeWrite, http.MethodGet, true},
+		{TokenScopeWrite, http.MethodPost, true},
+		{TokenScopeWrite, http.MethodDelete, true},
+		{TokenScope(""), http.MethodPost, false},
+	}
+	for _, test := range tests {
+		token := APIToken{Scope: test.scope}
+		if got := token.Allows(test.method); got != test.want {
+			t.Errorf("%q token Allows(%s) = %v, want %v", test.scope, test.method, got, test.want)
+		}
+	}
+}
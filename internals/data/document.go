@@ -1,20 +1,36 @@
 package data
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var (
+	ErrVersionConflict = errors.New("document was modified concurrently")
+	ErrInvalidSibling  = errors.New("sibling document does not belong to the target parent")
+)
+
+// Sibling ranks are spread by positionGap so that a move only rewrites the
+// moved row. Once float64 cannot fit a rank between two neighbours the
+// siblings are renumbered.
+const positionGap = 1024
+
 // TYPEDEF Documents
 type Document struct {
 	ID               uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();index" json:"id"`
 	Title            string         `json:"title"`
 	UserID           string         `gorm:"index" json:"userId"`
+	WorkspaceID      *uuid.UUID     `gorm:"type:uuid;index" json:"workspaceId"`
 	IsArchived       bool           `gorm:"default=false" json:"isArchived"`
+	ArchiveBatchID   *uuid.UUID     `gorm:"type:uuid" json:"-"` // set by the Archive call that archived the document
 	IsPublished      bool           `gorm:"default=false" json:"isPublished"`
 	ParentDocumentID *string        `gorm:"index,type:uuid" json:"parentDocumentId"`
 	ChildDocuments   []Document     `gorm:"foreignKey:ParentDocumentID" json:"-"`
@@ -22,6 +38,8 @@ type Document struct {
 	MdContent        *string        `json:"mdContent"` // for full text search only
 	CoverImage       *string        `json:"coverImage"`
 	Icon             *string        `json:"icon"`
+	Version          int64          `gorm:"not null;default:1" json:"version"`
+	Position         float64        `gorm:"not null;default:0" json:"position"`
 	CreatedAt        time.Time      `json:"createdAt"`
 	UpdatedAt        time.Time      `json:"updatedAt"`
 	DeletedAt        gorm.DeletedAt `gorm:"index" json:"deletedAt"`
@@ -112,14 +130,69 @@ func (doc Document) ToSearchObject() map[string]any {
 	}
 }
 
+// Lightweight view of a document for the sidebar tree
+type DocumentTreeNode struct {
+	ID          uuid.UUID          `json:"id"`
+	Title       string             `json:"title"`
+	Icon        *string            `json:"icon"`
+	Position    float64            `json:"position"`
+	ChildCount  int                `json:"childCount"`
+	HasChildren bool               `json:"hasChildren"`
+	Children    []DocumentTreeNode `json:"children,omitempty"`
+}
+
+func newDocumentTreeNode(doc Document, childCounts map[uuid.UUID]int) DocumentTreeNode {
+	node := DocumentTreeNode{
+		ID:          doc.ID,
+		Title:       doc.Title,
+		Icon:        doc.Icon,
+		Position:    doc.Position,
+		ChildCount:  childCounts[doc.ID],
+		HasChildren: childCounts[doc.ID] > 0,
+	}
+	for _, child := range doc.ChildDocuments {
+		node.Children = append(node.Children, newDocumentTreeNode(child, childCounts))
+	}
+	return node
+}
+
+// Facts about a prospective parent, gathered in one query by CheckParent
+type ParentCheck struct {
+	Exists            bool
+	UserID            string
+	WorkspaceID       *uuid.UUID
+	IsSharedWorkspace bool // the workspace of the parent is not a personal one
+	IsArchived        bool
+	IsDeleted         bool
+	CreatesCycle      bool
+}
+
 // DOCUMENT MODEL AND IMPLEMENTATION
 type DocumentRepositoryInterface interface {
+	Transaction(func(DocumentRepositoryInterface) error) error
+	Unscoped() DocumentRepositoryInterface
 	Save(*Document) error
-	Delete(*Document) error
-	Archive(*Document) error
-	Restore(*Document) error
+	Update(*Document) error
+	Delete(*Document) ([]uuid.UUID, error)
+	Archive(*Document) ([]uuid.UUID, error)
+	Restore(*Document) ([]uuid.UUID, error)
+	Undelete(*Document) ([]uuid.UUID, error)
 	Get(interface{}, ...any) ([]Document, error)
+	Find(ids []uuid.UUID) ([]Document, error)
+	Stream(batchSize int, fn func([]Document) error, query interface{}, args ...any) error
+	EnqueueIndex(op IndexOperation, ids ...uuid.UUID) error
+	RecordBaseline(doc *Document) error
+	GetPage(page Page, query interface{}, args ...any) ([]Document, string, int64, error)
+	NextPosition(userID string, parentID *string) (float64, error)
+	Move(doc *Document, parentID, beforeID, afterID *string) error
+	CheckParent(documentID uuid.UUID, parentID string) (*ParentCheck, error)
+	Tree(userID string, rootID *string, depth int) ([]DocumentTreeNode, error)
+	Ancestors(doc *Document) ([]Document, error)
+	Subtree(doc *Document) ([]Document, error)
+	Duplicate(doc *Document, userID string, workspaceID *uuid.UUID, includeDescendants bool, titleSuffix string) ([]Document, error)
+	CreateFromTemplate(doc *Document, pages []TemplatePage) ([]Document, error)
 	First(interface{}, ...any) (*Document, error)
+	Purge(cutoff time.Time, limit int) ([]uuid.UUID, error)
 }
 
 type DocumentRepository struct {
@@ -132,6 +205,19 @@ func NewDocumentRepository(db *gorm.DB) DocumentRepository {
 	}
 }
 
+// Run fn against a repository bound to a single database transaction.
+// Nested calls become savepoints.
+func (repo DocumentRepository) Transaction(fn func(DocumentRepositoryInterface) error) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		return fn(NewDocumentRepository(tx))
+	})
+}
+
+// Repository that also sees soft deleted documents
+func (repo DocumentRepository) Unscoped() DocumentRepositoryInterface {
+	return NewDocumentRepository(repo.db.Unscoped())
+}
+
 func (repo DocumentRepository) Save(doc *Document) error {
 	if err := repo.db.Save(doc).Error; err != nil {
 		return err
@@ -139,14 +225,531 @@ func (repo DocumentRepository) Save(doc *Document) error {
 	return nil
 }
 
+// Conditionally write doc, only if nobody bumped its version since it was loaded.
+// Returns ErrVersionConflict when the stored version moved on. Every other
+// statement that changes documents bumps their version too, so a stale copy
+// can never overwrite them.
+func (repo DocumentRepository) Update(doc *Document) error {
+	version := doc.Version
+	doc.Version = version + 1
+	result := repo.db.Model(doc).
+		Where("version = ?", version).
+		Select("*").
+		Omit("id", "created_at", "deleted_at", clause.Associations).
+		Updates(doc)
+	if result.Error != nil {
+		doc.Version = version
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		doc.Version = version
+		return ErrVersionConflict
+	}
+	return nil
+}
+
 func (repo DocumentRepository) Get(query interface{}, args ...any) ([]Document, error) {
 	documents := make([]Document, 0)
-	if err := repo.db.Where(query, args).Find(&documents).Order("created_at asc").Error; err != nil {
+	if err := repo.db.Where(query, args...).Order("created_at asc").Find(&documents).Error; err != nil {
+		return documents, err
+	}
+	return documents, nil
+}
+
+// Documents by ID, deleted ones included
+func (repo DocumentRepository) Find(ids []uuid.UUID) ([]Document, error) {
+	documents := make([]Document, 0)
+	if len(ids) == 0 {
+		return documents, nil
+	}
+	if err := repo.db.Unscoped().Where("id IN ?", ids).Find(&documents).Error; err != nil {
+		return documents, err
+	}
+	return documents, nil
+}
+
+// Walk every document matching query, deleted ones included, in batches of
+// batchSize ordered by id, so the whole table never sits in memory
+func (repo DocumentRepository) Stream(batchSize int, fn func([]Document) error, query interface{}, args ...any) error {
+	var lastID *uuid.UUID
+	for {
+		documents := make([]Document, 0, batchSize)
+		tx := repo.db.Unscoped().Where(query, args...)
+		if lastID != nil {
+			tx = tx.Where("id > ?", *lastID)
+		}
+		if err := tx.Order("id asc").Limit(batchSize).Find(&documents).Error; err != nil {
+			return err
+		}
+		if len(documents) == 0 {
+			return nil
+		}
+		if err := fn(documents); err != nil {
+			return err
+		}
+		if len(documents) < batchSize {
+			return nil
+		}
+		lastID = &documents[len(documents)-1].ID
+	}
+}
+
+// Queue a search index mutation for every id. Run it in the same Transaction
+// as the change it reflects so the index cannot drift from the database.
+func (repo DocumentRepository) EnqueueIndex(op IndexOperation, ids ...uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	entries := newOutboxEntries(op, ids, repo.db.NowFunc())
+	return repo.db.Create(&entries).Error
+}
+
+// Snapshot the stored state of doc as its first revision when it has none,
+// as for documents older than revisions and fresh copies. Run it in the same
+// Transaction as the change, before it.
+func (repo DocumentRepository) RecordBaseline(doc *Document) error {
+	statement := `
+	INSERT INTO document_revisions (document_id, user_id, title, content, md_content, cover_image, icon, created_at, updated_at)
+	SELECT d.id, d.user_id, d.title, d.content, d.md_content, d.cover_image, d.icon,
+		COALESCE(d.updated_at, NOW()), COALESCE(d.updated_at, NOW())
+		FROM documents d
+		WHERE d.id = ?
+			AND NOT EXISTS (SELECT 1 FROM document_revisions r WHERE r.document_id = d.id)
+	`
+	return repo.db.Exec(statement, doc.ID).Error
+}
+
+// Keyset paginated Get. Returns the opaque cursor of the next page, empty on
+// the last one, and the number of documents matching query across all pages.
+// A zero Limit returns every match in one go.
+func (repo DocumentRepository) GetPage(page Page, query interface{}, args ...any) ([]Document, string, int64, error) {
+	documents := make([]Document, 0)
+	column, after, order, err := page.keyset()
+	if err != nil {
+		return documents, "", 0, err
+	}
+
+	tx := repo.db.Where(query, args...)
+	if page.Cursor != "" {
+		value, id, err := page.decodeCursor(column)
+		if err != nil {
+			return documents, "", 0, err
+		}
+		tx = tx.Where(after, value, id)
+	}
+	tx = tx.Order(order)
+	if page.Limit > 0 {
+		tx = tx.Limit(page.Limit + 1)
+	}
+	if err := tx.Find(&documents).Error; err != nil {
+		return documents, "", 0, err
+	}
+
+	if page.Limit == 0 || (page.Cursor == "" && len(documents) <= page.Limit) {
+		return documents, "", int64(len(documents)), nil
+	}
+	var total int64
+	if err := repo.db.Model(&Document{}).Where(query, args...).Count(&total).Error; err != nil {
+		return documents, "", 0, err
+	}
+	if len(documents) <= page.Limit {
+		return documents, "", total, nil
+	}
+	documents = documents[:page.Limit]
+	return documents, page.encodeCursor(documents[len(documents)-1]), total, nil
+}
+
+// Documents ranked together with a document of userID under parentID: every
+// child of the parent whoever wrote it, or the top level documents of userID
+func siblingsOf(tx *gorm.DB, userID string, parentID *string) *gorm.DB {
+	if parentID != nil {
+		return tx.Model(&Document{}).Where("parent_document_id = ?", *parentID)
+	}
+	return tx.Model(&Document{}).Where("user_id = ? AND parent_document_id IS NULL", userID)
+}
+
+// Rank that places a new document after all of its future siblings
+func (repo DocumentRepository) NextPosition(userID string, parentID *string) (float64, error) {
+	var last *float64
+	err := siblingsOf(repo.db, userID, parentID).
+		Select("MAX(position)").
+		Scan(&last).Error
+	if err != nil || last == nil {
+		return positionGap, err
+	}
+	return *last + positionGap, nil
+}
+
+// Re-parent doc under parentID and place it right before beforeID or right
+// after afterID. Without an anchor the document goes last. Only the moved row
+// is written unless the neighbouring ranks ran out of room.
+func (repo DocumentRepository) Move(doc *Document, parentID, beforeID, afterID *string) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		siblings := func() *gorm.DB {
+			return siblingsOf(tx, doc.UserID, parentID).Where("id <> ?", doc.ID)
+		}
+
+		position, err := repo.rankBetween(siblings, beforeID, afterID)
+		if errors.Is(err, errNoRoom) {
+			if err := repo.rebalance(tx, doc, parentID); err != nil {
+				return err
+			}
+			position, err = repo.rankBetween(siblings, beforeID, afterID)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(doc).UpdateColumns(map[string]any{
+			"parent_document_id": parentID,
+			"position":           position,
+			"version":            gorm.Expr("version + 1"),
+			"updated_at":         tx.NowFunc(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.First(doc, "id = ?", doc.ID).Error
+	})
+}
+
+// Look up parentID and walk its ancestors to tell whether attaching
+// documentID under it would create a cycle. The path array guards the walk
+// against cycles already present in the data.
+func (repo DocumentRepository) CheckParent(documentID uuid.UUID, parentID string) (*ParentCheck, error) {
+	statement := `
+	WITH RECURSIVE ancestors AS (
+	SELECT documents.id, documents.parent_document_id, ARRAY[documents.id] AS path
+		FROM documents
+		WHERE documents.id = @parent
+		UNION ALL
+	SELECT parent.id, parent.parent_document_id, a.path || parent.id
+		FROM ancestors a JOIN documents parent ON parent.id = a.parent_document_id
+		WHERE NOT parent.id = ANY(a.path)
+		)
+	SELECT true AS exists,
+		p.user_id,
+		p.workspace_id,
+		(w.id IS NOT NULL AND w.personal_owner_id IS NULL) AS is_shared_workspace,
+		COALESCE(p.is_archived, false) AS is_archived,
+		p.deleted_at IS NOT NULL AS is_deleted,
+		EXISTS (SELECT 1 FROM ancestors WHERE ancestors.id = @document) AS creates_cycle
+		FROM documents p
+		LEFT JOIN workspaces w ON w.id = p.workspace_id
+		WHERE p.id = @parent
+	`
+	check := ParentCheck{}
+	err := repo.db.Raw(statement, sql.Named("parent", parentID), sql.Named("document", documentID)).Scan(&check).Error
+	if err != nil {
+		return nil, err
+	}
+	return &check, nil
+}
+
+// Load the non archived documents under rootID, at most depth levels deep,
+// in a single recursive query. Without rootID the tree starts at the top
+// level documents of userID; below a root it holds the documents of every
+// author. Nodes on the last level keep their child count so the client knows
+// they can be expanded.
+func (repo DocumentRepository) Tree(userID string, rootID *string, depth int) ([]DocumentTreeNode, error) {
+	level := "documents.user_id = @user AND documents.parent_document_id IS NULL"
+	if rootID != nil {
+		level = "documents.parent_document_id = @root"
+	}
+	statement := fmt.Sprintf(`
+	WITH RECURSIVE tree AS (
+	SELECT documents.*, 1 AS depth
+		FROM documents
+		WHERE %s
+			AND documents.is_archived = false
+			AND documents.deleted_at IS NULL
+		UNION ALL
+	SELECT child.*, tree.depth + 1
+		FROM tree JOIN documents child ON child.parent_document_id = tree.id
+		WHERE tree.depth < @depth
+			AND child.is_archived = false
+			AND child.deleted_at IS NULL
+		)
+	SELECT tree.*,
+		(SELECT COUNT(*) FROM documents c
+			WHERE c.parent_document_id = tree.id AND c.is_archived = false AND c.deleted_at IS NULL
+		) AS child_count
+		FROM tree
+		ORDER BY tree.depth DESC, tree.position ASC, tree.created_at ASC
+	`, level)
+	type treeRow struct {
+		Document
+		Depth      int
+		ChildCount int
+	}
+	rows := []treeRow{}
+	err := repo.db.Raw(statement, sql.Named("user", userID), sql.Named("root", rootID), sql.Named("depth", depth)).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// rows come deepest first, so every document has collected all of its
+	// children by the time it is copied into its own parent
+	documents := make(map[uuid.UUID]*Document, len(rows))
+	childCounts := make(map[uuid.UUID]int, len(rows))
+	for i := range rows {
+		documents[rows[i].ID] = &rows[i].Document
+		childCounts[rows[i].ID] = rows[i].ChildCount
+	}
+	roots := []Document{}
+	for _, row := range rows {
+		doc := documents[row.ID]
+		if row.Depth == 1 {
+			roots = append(roots, *doc)
+			continue
+		}
+		if parent, ok := documents[uuid.MustParse(*doc.ParentDocumentID)]; ok {
+			parent.ChildDocuments = append(parent.ChildDocuments, *doc)
+		}
+	}
+
+	nodes := make([]DocumentTreeNode, 0, len(roots))
+	for _, root := range roots {
+		nodes = append(nodes, newDocumentTreeNode(root, childCounts))
+	}
+	return nodes, nil
+}
+
+// Chain of parents of doc, ordered from the root down to its direct parent
+func (repo DocumentRepository) Ancestors(doc *Document) ([]Document, error) {
+	statement := `
+	WITH RECURSIVE ancestors AS (
+	SELECT parent.*, 1 AS depth, ARRAY[parent.id] AS path
+		FROM documents parent
+		WHERE parent.id = ?
+		UNION ALL
+	SELECT parent.*, a.depth + 1, a.path || parent.id
+		FROM ancestors a JOIN documents parent ON parent.id = a.parent_document_id
+		WHERE NOT parent.id = ANY(a.path)
+		)
+	SELECT * FROM ancestors
+		WHERE ancestors.deleted_at IS NULL
+		ORDER BY ancestors.depth DESC
+	`
+	documents := make([]Document, 0)
+	if doc.ParentDocumentID == nil {
+		return documents, nil
+	}
+	if err := repo.db.Raw(statement, *doc.ParentDocumentID).Scan(&documents).Error; err != nil {
+		return documents, err
+	}
+	return documents, nil
+}
+
+// doc followed by its non archived descendants, parents always before their
+// children and siblings in sidebar order
+func (repo DocumentRepository) Subtree(doc *Document) ([]Document, error) {
+	statement := `
+	WITH RECURSIVE d AS (
+	SELECT documents.*, 0 AS depth
+		FROM documents
+		WHERE documents.id = ?
+		UNION ALL
+	SELECT child.*, d.depth + 1
+		FROM d JOIN documents child ON child.parent_document_id = d.id
+		WHERE child.is_archived = false AND child.deleted_at IS NULL
+		)
+	SELECT * FROM d ORDER BY d.depth ASC, d.position ASC
+	`
+	documents := make([]Document, 0)
+	if err := repo.db.Raw(statement, doc.ID).Scan(&documents).Error; err != nil {
 		return documents, err
 	}
 	return documents, nil
 }
 
+// Clone doc, and optionally its non archived descendants, in one transaction.
+// The copies belong to userID, who made them, and to workspaceID. Parents are
+// remapped onto the new IDs, the root copy gets titleSuffix and lands right
+// after the original, or last among the top level documents of userID when
+// the original is another user's. Copies start unpublished; the root is
+// returned first.
+func (repo DocumentRepository) Duplicate(doc *Document, userID string, workspaceID *uuid.UUID, includeDescendants bool, titleSuffix string) ([]Document, error) {
+	var copies []Document
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		originals := []Document{*doc}
+		if includeDescendants {
+			var err error
+			if originals, err = (DocumentRepository{db: tx}).Subtree(doc); err != nil {
+				return err
+			}
+		}
+
+		ids := make(map[string]string, len(originals))
+		for _, original := range originals {
+			ids[original.ID.String()] = uuid.NewString()
+		}
+		copies = make([]Document, 0, len(originals))
+		for _, original := range originals {
+			clone := Document{
+				ID:               uuid.MustParse(ids[original.ID.String()]),
+				Title:            original.Title,
+				UserID:           userID,
+				WorkspaceID:      workspaceID,
+				ParentDocumentID: original.ParentDocumentID,
+				Content:          original.Content,
+				MdContent:        original.MdContent,
+				CoverImage:       original.CoverImage,
+				Icon:             original.Icon,
+				Position:         original.Position,
+			}
+			if original.ID != doc.ID {
+				parentID := ids[*original.ParentDocumentID]
+				clone.ParentDocumentID = &parentID
+			}
+			copies = append(copies, clone)
+		}
+
+		root := &copies[0]
+		root.Title += titleSuffix
+		var after *string
+		if doc.UserID == userID {
+			originalID := doc.ID.String()
+			after = &originalID
+		} else {
+			root.ParentDocumentID = nil
+		}
+		siblings := func() *gorm.DB {
+			return siblingsOf(tx, userID, root.ParentDocumentID)
+		}
+		position, err := repo.rankBetween(siblings, nil, after)
+		if errors.Is(err, errNoRoom) {
+			if err := repo.rebalance(tx, root, root.ParentDocumentID); err != nil {
+				return err
+			}
+			position, err = repo.rankBetween(siblings, nil, after)
+		}
+		if err != nil {
+			return err
+		}
+		root.Position = position
+
+		return tx.Omit(clause.Associations).Create(&copies).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+// Create doc and, below it, one document per template page in one transaction.
+// Returns every created document, doc first.
+func (repo DocumentRepository) CreateFromTemplate(doc *Document, pages []TemplatePage) ([]Document, error) {
+	created := []Document{}
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(doc).Error; err != nil {
+			return err
+		}
+		created = append(created, *doc)
+
+		var createPages func(parentID string, pages []TemplatePage) error
+		createPages = func(parentID string, pages []TemplatePage) error {
+			for i, page := range pages {
+				child := page.NewDocument(doc.UserID)
+				child.WorkspaceID = doc.WorkspaceID
+				child.ParentDocumentID = &parentID
+				child.Position = float64(i+1) * positionGap
+				if err := tx.Create(&child).Error; err != nil {
+					return err
+				}
+				created = append(created, child)
+				if err := createPages(child.ID.String(), page.Children); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return createPages(doc.ID.String(), pages)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+var errNoRoom = errors.New("no room between sibling positions")
+
+func (repo DocumentRepository) rankBetween(siblings func() *gorm.DB, beforeID, afterID *string) (float64, error) {
+	var anchor Document
+	var neighbour *float64
+	var lo, hi float64
+
+	switch {
+	case beforeID != nil:
+		if err := siblings().Where("id = ?", *beforeID).Take(&anchor).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return 0, ErrInvalidSibling
+			}
+			return 0, err
+		}
+		err := siblings().Select("MAX(position)").Where("position < ?", anchor.Position).Scan(&neighbour).Error
+		if err != nil {
+			return 0, err
+		}
+		hi = anchor.Position
+		lo = hi - positionGap
+		if neighbour != nil {
+			lo = *neighbour
+		}
+	case afterID != nil:
+		if err := siblings().Where("id = ?", *afterID).Take(&anchor).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return 0, ErrInvalidSibling
+			}
+			return 0, err
+		}
+		err := siblings().Select("MIN(position)").Where("position > ?", anchor.Position).Scan(&neighbour).Error
+		if err != nil {
+			return 0, err
+		}
+		lo = anchor.Position
+		hi = lo + positionGap
+		if neighbour != nil {
+			hi = *neighbour
+		}
+	default:
+		if err := siblings().Select("MAX(position)").Scan(&neighbour).Error; err != nil {
+			return 0, err
+		}
+		if neighbour != nil {
+			lo = *neighbour
+		}
+		hi = lo + 2*positionGap
+	}
+
+	return midpoint(lo, hi)
+}
+
+// Rank halfway between lo and hi. Returns errNoRoom once the gap is down to
+// the float64 resolution at that magnitude, where the result would equal one
+// of the bounds.
+func midpoint(lo, hi float64) (float64, error) {
+	mid := lo + (hi-lo)/2
+	if !(lo < mid && mid < hi) {
+		return 0, errNoRoom
+	}
+	return mid, nil
+}
+
+// Renumber all siblings of the target group with fresh gaps
+func (repo DocumentRepository) rebalance(tx *gorm.DB, doc *Document, parentID *string) error {
+	ranks := siblingsOf(tx, doc.UserID, parentID).
+		Select("id, row_number() OVER (ORDER BY position, created_at) AS rank").
+		Where("id <> ?", doc.ID)
+	statement := `
+	UPDATE documents d set position = r.rank * ?, version = d.version + 1
+		FROM (?) r
+		WHERE r.id = d.id
+	`
+	return tx.Exec(statement, positionGap, ranks).Error
+}
+
 func (repo DocumentRepository) First(query interface{}, args ...any) (*Document, error) {
 	var document Document
 	if err := repo.db.First(&document, query, args).Error; err != nil {
@@ -155,7 +758,10 @@ func (repo DocumentRepository) First(query interface{}, args ...any) (*Document,
 	return &document, nil
 }
 
-func (repo DocumentRepository) Archive(doc *Document) error {
+// Archive doc and its whole subtree. The documents archived here share a
+// fresh archive batch ID, so Restore can bring them back together. Returns
+// the IDs that actually changed.
+func (repo DocumentRepository) Archive(doc *Document) ([]uuid.UUID, error) {
 	statement := `
 	WITH RECURSIVE d AS (
   	SELECT documents.id
@@ -165,23 +771,26 @@ func (repo DocumentRepository) Archive(doc *Document) error {
   	SELECT child.id
   		FROM d JOIN documents child ON child.parent_document_id = d.id
 		)
-	UPDATE documents b set is_archived = true
+	UPDATE documents b set is_archived = true, archive_batch_id = ?, version = version + 1, updated_at = NOW()
  		FROM d
- 		WHERE d.id = b.id
+ 		WHERE d.id = b.id AND b.is_archived IS NOT TRUE AND b.deleted_at IS NULL
+		RETURNING b.id
 	`
 
-	if err := repo.db.Exec(statement, doc.ID).Error; err != nil {
-		return err
+	ids := []uuid.UUID{}
+	if err := repo.db.Raw(statement, doc.ID, uuid.New()).Scan(&ids).Error; err != nil {
+		return nil, err
 	}
 
 	// not really required, but It would be cleaner to reload the state of archived object
 	if err := repo.db.Preload("ChildDocuments").Find(doc).Error; err != nil {
 		slog.Warn("error realoading object", slog.Attr{Key: "error", Value: slog.StringValue(err.Error())})
 	}
-	return nil
+	return ids, nil
 }
 
-func (repo DocumentRepository) Delete(doc *Document) error {
+// Soft delete doc and its whole subtree. Returns the IDs that actually changed.
+func (repo DocumentRepository) Delete(doc *Document) ([]uuid.UUID, error) {
 	statement := `
 	WITH RECURSIVE d AS (
   	SELECT documents.id
@@ -191,29 +800,138 @@ func (repo DocumentRepository) Delete(doc *Document) error {
   	SELECT child.id
   		FROM d JOIN documents child ON child.parent_document_id = d.id
 		)
-    UPDATE documents b set deleted_at = NOW()::TIMESTAMP
+    UPDATE documents b set deleted_at = NOW()::TIMESTAMP, version = version + 1, updated_at = NOW()
  		FROM d
- 		WHERE d.id = b.id
+ 		WHERE d.id = b.id AND b.deleted_at IS NULL
+		RETURNING b.id
 	`
-	if err := repo.db.Exec(statement, doc.ID).Error; err != nil {
-		return err
+	ids := []uuid.UUID{}
+	if err := repo.db.Raw(statement, doc.ID).Scan(&ids).Error; err != nil {
+		return nil, err
 	}
 	if err := repo.db.Preload("ChildDocuments").Find(doc).Error; err != nil {
 		slog.Warn("error realoading object", slog.Attr{Key: "error", Value: slog.StringValue(err.Error())})
 	}
-	return nil
+	return ids, nil
 }
 
-func (repo DocumentRepository) Restore(doc *Document) error {
-	doc.IsArchived = false
+// Unarchive doc along with its archived ancestors, so it shows up again in
+// the tree, and the descendants archived by the same Archive call, so a
+// restored folder is not empty. Descendants archived on their own stay
+// archived. Returns the IDs that actually changed.
+func (repo DocumentRepository) Restore(doc *Document) ([]uuid.UUID, error) {
+	statement := `
+	WITH RECURSIVE a AS (
+	SELECT documents.id, documents.parent_document_id
+		FROM documents
+		WHERE documents.id = @id
+		UNION ALL
+	SELECT parent.id, parent.parent_document_id
+		FROM a JOIN documents parent ON parent.id = a.parent_document_id
+		WHERE parent.is_archived = true AND parent.deleted_at IS NULL
+		), d AS (
+	SELECT documents.id, documents.archive_batch_id
+		FROM documents
+		WHERE documents.id = @id
+		UNION ALL
+	SELECT child.id, child.archive_batch_id
+		FROM d JOIN documents child ON child.parent_document_id = d.id
+		WHERE child.deleted_at IS NULL
+		)
+	UPDATE documents b set is_archived = false, archive_batch_id = NULL, version = version + 1, updated_at = NOW()
+		WHERE b.is_archived IS NOT FALSE
+			AND (b.id IN (SELECT a.id FROM a) OR b.id IN (SELECT d.id FROM d WHERE d.archive_batch_id = @batch))
+		RETURNING b.id
+	`
+	ids := []uuid.UUID{}
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Raw(statement, sql.Named("id", doc.ID), sql.Named("batch", doc.ArchiveBatchID)).Scan(&ids).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.db.Find(doc).Error; err != nil {
+		slog.Warn("error realoading object", slog.Attr{Key: "error", Value: slog.StringValue(err.Error())})
+	}
+	return ids, nil
+}
+
+// Bring a soft deleted doc back along with the descendants deleted with it.
+// Children deleted on their own before doc stay deleted. When the parent of
+// doc is still deleted, doc is moved to the top level instead. Returns the
+// IDs that actually changed.
+func (repo DocumentRepository) Undelete(doc *Document) ([]uuid.UUID, error) {
+	if !doc.DeletedAt.Valid {
+		return []uuid.UUID{}, nil
+	}
 	if doc.ParentDocumentID != nil {
-		parentDocument := Document{}
-		if err := repo.db.First(&parentDocument, "id = ?", doc.ParentDocumentID).Error; err != nil {
-			return err
+		var deletedParents int64
+		err := repo.db.Unscoped().Model(&Document{}).
+			Where("id = ? AND deleted_at IS NOT NULL", *doc.ParentDocumentID).
+			Count(&deletedParents).Error
+		if err != nil {
+			return nil, err
 		}
-		if err := repo.Restore(&parentDocument); err != nil {
-			return err
+		if deletedParents > 0 {
+			position, err := repo.NextPosition(doc.UserID, nil)
+			if err != nil {
+				return nil, err
+			}
+			err = repo.db.Unscoped().Model(doc).UpdateColumns(map[string]any{
+				"parent_document_id": nil,
+				"position":           position,
+				"version":            gorm.Expr("version + 1"),
+			}).Error
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
-	return repo.db.Save(doc).Error
+
+	statement := `
+	WITH RECURSIVE d AS (
+  	SELECT documents.id
+   		FROM documents
+   		WHERE documents.id = ?
+ 		UNION ALL
+  	SELECT child.id
+  		FROM d JOIN documents child ON child.parent_document_id = d.id
+  		WHERE child.deleted_at >= ?
+		)
+	UPDATE documents b set deleted_at = NULL, version = version + 1, updated_at = NOW()
+ 		FROM d
+ 		WHERE d.id = b.id AND b.deleted_at IS NOT NULL
+		RETURNING b.id
+	`
+	ids := []uuid.UUID{}
+	if err := repo.db.Raw(statement, doc.ID, doc.DeletedAt.Time).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	if err := repo.db.Find(doc).Error; err != nil {
+		slog.Warn("error realoading object", slog.Attr{Key: "error", Value: slog.StringValue(err.Error())})
+	}
+	return ids, nil
+}
+
+// Hard delete up to limit documents soft deleted before cutoff. Only leaves
+// go, since fk_documents_child_documents still holds the rows of a parent
+// whose children are around, so calling Purge until it returns nothing
+// clears whole subtrees bottom up. Revisions follow through their cascade.
+func (repo DocumentRepository) Purge(cutoff time.Time, limit int) ([]uuid.UUID, error) {
+	statement := `
+	DELETE FROM documents
+		WHERE id IN (
+			SELECT d.id
+				FROM documents d
+				WHERE d.deleted_at < ?
+					AND NOT EXISTS (SELECT 1 FROM documents child WHERE child.parent_document_id = d.id)
+				LIMIT ?
+		)
+		RETURNING id
+	`
+	ids := []uuid.UUID{}
+	if err := repo.db.Raw(statement, cutoff, limit).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
 }
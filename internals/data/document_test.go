@@ -0,0 +1,53 @@
+package data
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMidpoint(t *testing.T) {
+	tests := []struct {
+		lo, hi float64
+		want   float64
+		err    error
+	}{
+		{0, 2 * positionGap, positionGap, nil},
+		{positionGap, 2 * positionGap, 1.5 * positionGap, nil},
+		{-positionGap, 0, -positionGap / 2, nil},
+		{1, 1, 0, errNoRoom},
+		{2, 1, 0, errNoRoom},
+		{1, math.Nextafter(1, 2), 0, errNoRoom},
+		{1e6, math.Nextafter(math.Nextafter(1e6, 2e6), 2e6), math.Nextafter(1e6, 2e6), nil},
+	}
+	for _, test := range tests {
+		got, err := midpoint(test.lo, test.hi)
+		if !errors.Is(err, test.err) {
+			t.Errorf("midpoint(%v, %v) error = %v, want %v", test.lo, test.hi, err, test.err)
+			continue
+		}
+		if err == nil && got != test.want {
+			t.Errorf("midpoint(%v, %v) = %v, want %v", test.lo, test.hi, got, test.want)
+		}
+	}
+}
+
+// Inserting again and again before the same sibling must run out of room
+// instead of handing out a rank that collides with a neighbour
+func TestMidpointRunsOutOfRoom(t *testing.T) {
+	lo, hi := float64(positionGap), float64(2*positionGap)
+	for i := 0; i < 1100; i++ {
+		mid, err := midpoint(lo, hi)
+		if errors.Is(err, errNoRoom) {
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if mid <= lo || mid >= hi {
+			t.Fatalf("midpoint(%v, %v) = %v, outside of the bounds", lo, hi, mid)
+		}
+		hi = mid
+	}
+	t.Fatal("midpoint never ran out of room")
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IndexOperation string
+
+const (
+	IndexSave   IndexOperation = "save"
+	IndexDelete IndexOperation = "delete"
+)
+
+// TYPEDEF OutboxEntries
+// A pending search index mutation, written in the same transaction as the
+// document change it mirrors and drained by the outbox worker
+type OutboxEntry struct {
+	ID          int64          `gorm:"primaryKey" json:"id"`
+	DocumentID  uuid.UUID      `gorm:"type:uuid" json:"documentId"`
+	Operation   IndexOperation `json:"operation"`
+	Attempts    int            `json:"attempts"`
+	AvailableAt time.Time      `json:"availableAt"`
+	LastError   *string        `json:"lastError"`
+	DeadAt      *time.Time     `json:"deadAt"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+func (OutboxEntry) TableName() string {
+	return "search_outbox"
+}
+
+func newOutboxEntries(op IndexOperation, ids []uuid.UUID, now time.Time) []OutboxEntry {
+	entries := make([]OutboxEntry, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, OutboxEntry{
+			DocumentID:  id,
+			Operation:   op,
+			AvailableAt: now,
+		})
+	}
+	return entries
+}
+
+// OUTBOX MODEL AND IMPLEMENTATION
+type OutboxRepositoryInterface interface {
+	Transaction(func(OutboxRepositoryInterface) error) error
+	Claim(limit int) ([]OutboxEntry, error)
+	Complete(ids []int64) error
+	Retry(ids []int64, reason string, availableAt time.Time) error
+	Bury(ids []int64, reason string) error
+}
+
+type OutboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return OutboxRepository{
+		db: db,
+	}
+}
+
+func (repo OutboxRepository) Transaction(fn func(OutboxRepositoryInterface) error) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		return fn(NewOutboxRepository(tx))
+	})
+}
+
+// Lock up to limit due entries, oldest first. Rows locked by another worker
+// are skipped, so several workers can drain the outbox side by side. Only
+// meaningful inside Transaction.
+func (repo OutboxRepository) Claim(limit int) ([]OutboxEntry, error) {
+	entries := make([]OutboxEntry, 0)
+	err := repo.db.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("dead_at IS NULL AND available_at <= ?", repo.db.NowFunc()).
+		Order("id asc").
+		Limit(limit).
+		Find(&entries).Error
+	if err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
+
+func (repo OutboxRepository) Complete(ids []int64) error {
+	return repo.db.Where("id IN ?", ids).Delete(&OutboxEntry{}).Error
+}
+
+// Put entries back in line for another attempt at availableAt
+func (repo OutboxRepository) Retry(ids []int64, reason string, availableAt time.Time) error {
+	return repo.db.Model(&OutboxEntry{}).Where("id IN ?", ids).Updates(map[string]any{
+		"attempts":     gorm.Expr("attempts + 1"),
+		"available_at": availableAt,
+		"last_error":   reason,
+	}).Error
+}
+
+// Dead-letter entries, they stay in the table for inspection but are never claimed again
+func (repo OutboxRepository) Bury(ids []int64, reason string) error {
+	return repo.db.Model(&OutboxEntry{}).Where("id IN ?", ids).Updates(map[string]any{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"dead_at":    repo.db.NowFunc(),
+		"last_error": reason,
+	}).Error
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort field")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Sortable fields, keyed by their JSON name
+var sortColumns = map[string]string{
+	"title":     "title",
+	"createdAt": "created_at",
+	"updatedAt": "updated_at",
+	"position":  "position",
+	"deletedAt": "deleted_at",
+}
+
+// Page selects a slice of a listing. Sort is one of the sortColumns keys,
+// prefixed with "-" for descending order. Cursor is the value returned along
+// the previous page. A zero Limit selects the whole listing.
+type Page struct {
+	Limit  int
+	Cursor string
+	Sort   string
+}
+
+type cursor struct {
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func (page Page) sortColumn() (string, bool, error) {
+	desc := strings.HasPrefix(page.Sort, "-")
+	column, ok := sortColumns[strings.TrimPrefix(page.Sort, "-")]
+	if !ok {
+		return "", false, ErrInvalidSort
+	}
+	return column, desc, nil
+}
+
+// Sort column, the condition selecting the rows after a cursor and the
+// ORDER BY clause. The ID breaks ties in the same direction.
+func (page Page) keyset() (string, string, string, error) {
+	column, desc, err := page.sortColumn()
+	if err != nil {
+		return "", "", "", err
+	}
+	op, direction := ">", "asc"
+	if desc {
+		op, direction = "<", "desc"
+	}
+	after := fmt.Sprintf("(%s, id) %s (?, ?)", column, op)
+	order := fmt.Sprintf("%s %s, id %s", column, direction, direction)
+	return column, after, order, nil
+}
+
+func (page Page) encodeCursor(last Document) string {
+	c := cursor{ID: last.ID.String()}
+	column, _, _ := page.sortColumn()
+	switch column {
+	case "title":
+		c.Value = last.Title
+	case "created_at":
+		c.Value = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "updated_at":
+		c.Value = last.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case "deleted_at":
+		c.Value = last.DeletedAt.Time.UTC().Format(time.RFC3339Nano)
+	case "position":
+		c.Value = strconv.FormatFloat(last.Position, 'g', -1, 64)
+	}
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Decode the cursor into the typed sort value and the tie breaking ID
+func (page Page) decodeCursor(column string) (any, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	c := cursor{}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	if err := uuid.Validate(c.ID); err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+
+	switch column {
+	case "created_at", "updated_at", "deleted_at":
+		value, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		return value, c.ID, nil
+	case "position":
+		value, err := strconv.ParseFloat(c.Value, 64)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		return value, c.ID, nil
+	default:
+		return c.Value, c.ID, nil
+	}
+}
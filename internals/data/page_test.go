@@ -0,0 +1,120 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestPageKeyset(t *testing.T) {
+	tests := []struct {
+		sort   string
+		column string
+		after  string
+		order  string
+		err    error
+	}{
+		{"title", "title", "(title, id) > (?, ?)", "title asc, id asc", nil},
+		{"-title", "title", "(title, id) < (?, ?)", "title desc, id desc", nil},
+		{"createdAt", "created_at", "(created_at, id) > (?, ?)", "created_at asc, id asc", nil},
+		{"-updatedAt", "updated_at", "(updated_at, id) < (?, ?)", "updated_at desc, id desc", nil},
+		{"position", "position", "(position, id) > (?, ?)", "position asc, id asc", nil},
+		{"-deletedAt", "deleted_at", "(deleted_at, id) < (?, ?)", "deleted_at desc, id desc", nil},
+		{"", "", "", "", ErrInvalidSort},
+		{"user_id", "", "", "", ErrInvalidSort},
+		{"--title", "", "", "", ErrInvalidSort},
+		{"title; DROP TABLE documents", "", "", "", ErrInvalidSort},
+	}
+	for _, test := range tests {
+		column, after, order, err := Page{Sort: test.sort}.keyset()
+		if !errors.Is(err, test.err) {
+			t.Errorf("keyset(%q) error = %v, want %v", test.sort, err, test.err)
+			continue
+		}
+		if column != test.column || after != test.after || order != test.order {
+			t.Errorf("keyset(%q) = %q, %q, %q, want %q, %q, %q",
+				test.sort, column, after, order, test.column, test.after, test.order)
+		}
+	}
+}
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 9, 14, 30, 15, 123456789, time.FixedZone("CET", 3600))
+	last := Document{
+		ID:        uuid.New(),
+		Title:     `Q1 "plans", drafts`,
+		CreatedAt: at,
+		UpdatedAt: at.Add(time.Hour),
+		DeletedAt: gorm.DeletedAt{Time: at.Add(2 * time.Hour), Valid: true},
+		Position:  1536.0009765625,
+	}
+
+	tests := []struct {
+		sort string
+		want any
+	}{
+		{"title", last.Title},
+		{"-createdAt", last.CreatedAt.UTC()},
+		{"updatedAt", last.UpdatedAt.UTC()},
+		{"-deletedAt", last.DeletedAt.Time.UTC()},
+		{"position", last.Position},
+	}
+	for _, test := range tests {
+		t.Run(test.sort, func(t *testing.T) {
+			page := Page{Sort: test.sort}
+			page.Cursor = page.encodeCursor(last)
+			column, _, err := page.sortColumn()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			value, id, err := page.decodeCursor(column)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if id != last.ID.String() {
+				t.Errorf("id = %s, want %s", id, last.ID)
+			}
+			if value != test.want {
+				t.Errorf("value = %v, want %v", value, test.want)
+			}
+		})
+	}
+}
+
+func TestPageDecodeInvalidCursor(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	id := uuid.NewString()
+
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{"not base64", "title", "not base64!"},
+		{"not json", "title", encode("title")},
+		{"missing id", "title", encode(`{"v":"a"}`)},
+		{"malformed id", "title", encode(`{"v":"a","id":"1; --"}`)},
+		{"malformed time", "createdAt", encode(`{"v":"yesterday","id":"` + id + `"}`)},
+		{"malformed position", "position", encode(`{"v":"first","id":"` + id + `"}`)},
+		{"cursor of another sort", "updatedAt", Page{Sort: "title"}.encodeCursor(Document{ID: uuid.New(), Title: "a"})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page := Page{Sort: test.sort, Cursor: test.cursor}
+			column, _, err := page.sortColumn()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, _, err := page.decodeCursor(column); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package data
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Role of a user on a document. Each role includes the ones before it.
+type Role string
+
+const (
+	RoleNone      Role = ""
+	RoleViewer    Role = "viewer"
+	RoleCommenter Role = "commenter"
+	RoleEditor    Role = "editor"
+	RoleOwner     Role = "owner"
+)
+
+var roleRanks = map[Role]int{
+	RoleNone:      0,
+	RoleViewer:    1,
+	RoleCommenter: 2,
+	RoleEditor:    3,
+	RoleOwner:     4,
+}
+
+// Whether role grants at least what other does
+func (role Role) Includes(other Role) bool {
+	return roleRanks[role] >= roleRanks[other]
+}
+
+// TYPEDEF DocumentPermissions
+// A role granted to a collaborator on a document, inherited by its whole
+// subtree. The document owner needs no permission row.
+type DocumentPermission struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid()" json:"id"`
+	DocumentID uuid.UUID `gorm:"type:uuid" json:"documentId"`
+	UserID     string    `json:"userId"`
+	Role       Role      `json:"role"`
+	GrantedBy  *string   `json:"grantedBy"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// PERMISSION MODEL AND IMPLEMENTATION
+type PermissionRepositoryInterface interface {
+	Grant(*DocumentPermission) error
+	Revoke(documentID uuid.UUID, userID string) error
+	Get(doc *Document) ([]DocumentPermission, error)
+	Role(doc *Document, userID string) (Role, error)
+}
+
+type PermissionRepository struct {
+	db *gorm.DB
+}
+
+func NewPermissionRepository(db *gorm.DB) PermissionRepository {
+	return PermissionRepository{
+		db: db,
+	}
+}
+
+// Create the permission, or change the role of an existing one for the same
+// document and user
+func (repo PermissionRepository) Grant(permission *DocumentPermission) error {
+	return repo.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "document_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "granted_by", "updated_at"}),
+	}).Create(permission).Error
+}
+
+// Returns gorm.ErrRecordNotFound when the user had no permission granted
+// directly on the document
+func (repo PermissionRepository) Revoke(documentID uuid.UUID, userID string) error {
+	result := repo.db.Where("document_id = ? AND user_id = ?", documentID, userID).Delete(&DocumentPermission{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Permissions that apply to doc, the ones granted on its ancestors included.
+// Those can be told apart by their DocumentID.
+func (repo PermissionRepository) Get(doc *Document) ([]DocumentPermission, error) {
+	statement := `
+	WITH RECURSIVE a AS (
+	SELECT documents.id, documents.parent_document_id
+		FROM documents
+		WHERE documents.id = ?
+		UNION ALL
+	SELECT parent.id, parent.parent_document_id
+		FROM a JOIN documents parent ON parent.id = a.parent_document_id
+		)
+	SELECT document_permissions.*
+		FROM document_permissions
+		WHERE document_permissions.document_id IN (SELECT a.id FROM a)
+		ORDER BY document_permissions.created_at asc
+	`
+	permissions := make([]DocumentPermission, 0)
+	if err := repo.db.Raw(statement, doc.ID).Scan(&permissions).Error; err != nil {
+		return permissions, err
+	}
+	return permissions, nil
+}
+
+// Effective role of userID on doc: owner for the document owner, otherwise
+// the strongest of the roles granted on doc or any of its ancestors and the
+// one given by a membership of the document workspace
+func (repo PermissionRepository) Role(doc *Document, userID string) (Role, error) {
+	if doc.UserID == userID {
+		return RoleOwner, nil
+	}
+	statement := `
+	WITH RECURSIVE a AS (
+	SELECT documents.id, documents.parent_document_id
+		FROM documents
+		WHERE documents.id = ?
+		UNION ALL
+	SELECT parent.id, parent.parent_document_id
+		FROM a JOIN documents parent ON parent.id = a.parent_document_id
+		)
+	SELECT document_permissions.role
+		FROM document_permissions
+		WHERE document_permissions.user_id = ? AND document_permissions.document_id IN (SELECT a.id FROM a)
+	`
+	roles := []Role{}
+	if err := repo.db.Raw(statement, doc.ID, userID).Scan(&roles).Error; err != nil {
+		return RoleNone, err
+	}
+	if doc.WorkspaceID != nil {
+		memberships := []WorkspaceRole{}
+		err := repo.db.Model(&WorkspaceMembership{}).
+			Where("workspace_id = ? AND user_id = ? AND "+liveMembership, *doc.WorkspaceID, userID).
+			Pluck("role", &memberships).Error
+		if err != nil {
+			return RoleNone, err
+		}
+		for _, membership := range memberships {
+			roles = append(roles, membership.DocumentRole())
+		}
+	}
+	role := RoleNone
+	for _, granted := range roles {
+		if granted.Includes(role) {
+			role = granted
+		}
+	}
+	return role, nil
+}
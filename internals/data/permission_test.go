@@ -0,0 +1,27 @@
+package data
+
+import "testing"
+
+func TestRoleIncludes(t *testing.T) {
+	tests := []struct {
+		role  Role
+		other Role
+		want  bool
+	}{
+		{RoleNone, RoleNone, true},
+		{RoleNone, RoleViewer, false},
+		{RoleViewer, RoleNone, true},
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleCommenter, false},
+		{RoleCommenter, RoleViewer, true},
+		{RoleEditor, RoleCommenter, true},
+		{RoleEditor, RoleOwner, false},
+		{RoleOwner, RoleEditor, true},
+		{Role("admin"), RoleViewer, false},
+	}
+	for _, test := range tests {
+		if got := test.role.Includes(test.other); got != test.want {
+			t.Errorf("%q.Includes(%q) = %v, want %v", test.role, test.other, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package data
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TYPEDEF DocumentRevisions
+type DocumentRevision struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid()" json:"id"`
+	DocumentID uuid.UUID `gorm:"type:uuid;index" json:"documentId"`
+	UserID     string    `json:"userId"`
+	Title      string    `json:"title"`
+	Content    *string   `json:"content,omitempty"`
+	MdContent  *string   `json:"mdContent,omitempty"`
+	CoverImage *string   `json:"coverImage"`
+	Icon       *string   `json:"icon"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Copy the revisioned attributes back onto the document
+func (rev DocumentRevision) ApplyTo(doc *Document) {
+	doc.Title = rev.Title
+	doc.Content = rev.Content
+	doc.MdContent = rev.MdContent
+	doc.CoverImage = rev.CoverImage
+	doc.Icon = rev.Icon
+}
+
+// RevisionRetention controls how many revisions are kept per document.
+// A zero value disables the corresponding limit.
+type RevisionRetention struct {
+	MaxCount       int
+	MaxAge         time.Duration
+	CoalesceWindow time.Duration
+}
+
+// Whether an edit by userID at now overwrites the first of latest, the most
+// recent revisions of the document. The first revision of a document is kept
+// as its baseline, so there must be one before.
+func (retention RevisionRetention) coalesces(latest []DocumentRevision, userID string, now time.Time) bool {
+	return len(latest) > 1 &&
+		retention.CoalesceWindow > 0 &&
+		latest[0].UserID == userID &&
+		now.Sub(latest[0].CreatedAt) < retention.CoalesceWindow
+}
+
+// REVISION MODEL AND IMPLEMENTATION
+type RevisionRepositoryInterface interface {
+	Record(doc *Document, userID string) (*DocumentRevision, error)
+	Get(documentID uuid.UUID) ([]DocumentRevision, error)
+	First(documentID uuid.UUID, revisionID string) (*DocumentRevision, error)
+}
+
+type RevisionRepository struct {
+	db        *gorm.DB
+	retention RevisionRetention
+}
+
+func NewRevisionRepository(db *gorm.DB, retention RevisionRetention) RevisionRepository {
+	return RevisionRepository{
+		db:        db,
+		retention: retention,
+	}
+}
+
+// Snapshot the current state of doc. Rapid edits by the same user within the
+// coalesce window overwrite the latest revision instead of creating a new one,
+// unless it is the first. The window runs from the creation of that revision,
+// so a long editing session still leaves one revision per window.
+func (repo RevisionRepository) Record(doc *Document, userID string) (*DocumentRevision, error) {
+	revision := DocumentRevision{
+		DocumentID: doc.ID,
+		UserID:     userID,
+	}
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		latest := []DocumentRevision{}
+		err := tx.Where("document_id = ?", doc.ID).Order("created_at desc").Limit(2).Find(&latest).Error
+		if err != nil {
+			return err
+		}
+
+		if repo.retention.coalesces(latest, userID, time.Now()) {
+			revision = latest[0]
+		}
+		revision.Title = doc.Title
+		revision.Content = doc.Content
+		revision.MdContent = doc.MdContent
+		revision.CoverImage = doc.CoverImage
+		revision.Icon = doc.Icon
+		if err := tx.Save(&revision).Error; err != nil {
+			return err
+		}
+
+		return repo.prune(tx, doc.ID, revision.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// Drop revisions outside of the retention policy, always keeping latestID
+func (repo RevisionRepository) prune(tx *gorm.DB, documentID, latestID uuid.UUID) error {
+	if repo.retention.MaxCount > 0 {
+		keep := tx.Model(&DocumentRevision{}).
+			Select("id").
+			Where("document_id = ?", documentID).
+			Order("created_at desc").
+			Limit(repo.retention.MaxCount)
+		err := tx.Where("document_id = ? AND id <> ? AND id NOT IN (?)", documentID, latestID, keep).
+			Delete(&DocumentRevision{}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if repo.retention.MaxAge > 0 {
+		cutoff := time.Now().UTC().Add(-repo.retention.MaxAge)
+		err := tx.Where("document_id = ? AND id <> ? AND updated_at < ?", documentID, latestID, cutoff).
+			Delete(&DocumentRevision{}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List revisions of a document, newest first. Contents are omitted to keep the listing light.
+func (repo RevisionRepository) Get(documentID uuid.UUID) ([]DocumentRevision, error) {
+	revisions := make([]DocumentRevision, 0)
+	err := repo.db.Omit("content", "md_content").
+		Where("document_id = ?", documentID).
+		Order("created_at desc").
+		Find(&revisions).Error
+	if err != nil {
+		return revisions, err
+	}
+	return revisions, nil
+}
+
+func (repo RevisionRepository) First(documentID uuid.UUID, revisionID string) (*DocumentRevision, error) {
+	var revision DocumentRevision
+	if err := repo.db.First(&revision, "document_id = ? AND id = ?", documentID, revisionID).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
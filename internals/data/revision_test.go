@@ -0,0 +1,40 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRevisionRetentionCoalesces(t *testing.T) {
+	now := time.Now()
+	window := RevisionRetention{CoalesceWindow: time.Minute}
+	revision := func(userID string, age time.Duration) DocumentRevision {
+		return DocumentRevision{ID: uuid.New(), UserID: userID, CreatedAt: now.Add(-age)}
+	}
+	baseline := revision("user_2", time.Hour)
+
+	tests := []struct {
+		name      string
+		retention RevisionRetention
+		latest    []DocumentRevision
+		userID    string
+		want      bool
+	}{
+		{"no revision", window, nil, "user_1", false},
+		{"baseline only", window, []DocumentRevision{revision("user_1", time.Second)}, "user_1", false},
+		{"same user within the window", window, []DocumentRevision{revision("user_1", 10*time.Second), baseline}, "user_1", true},
+		{"same user past the window", window, []DocumentRevision{revision("user_1", 2*time.Minute), baseline}, "user_1", false},
+		{"same user at the window end", window, []DocumentRevision{revision("user_1", time.Minute), baseline}, "user_1", false},
+		{"other user within the window", window, []DocumentRevision{revision("user_2", 10*time.Second), baseline}, "user_1", false},
+		{"coalescing disabled", RevisionRetention{}, []DocumentRevision{revision("user_1", time.Second), baseline}, "user_1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.retention.coalesces(test.latest, test.userID, now); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Prefix of share link tokens, makes them easy to spot in logs and scanners
+const ShareTokenPrefix = "shr_"
+
+// TYPEDEF ShareLinks
+// An unlisted link granting Role on a document, and on its descendants when
+// IncludeDescendants is set, to anyone holding the token
+type ShareLink struct {
+	ID                 uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid()" json:"id"`
+	DocumentID         uuid.UUID  `gorm:"type:uuid" json:"documentId"`
+	CreatedBy          string     `json:"createdBy"`
+	TokenHash          string     `json:"-"`
+	Token              string     `gorm:"-" json:"token,omitempty"`
+	Role               Role       `json:"role"`
+	PasswordHash       *string    `json:"-"`
+	Protected          bool       `gorm:"-" json:"protected"`
+	IncludeDescendants bool       `json:"includeDescendants"`
+	ExpiresAt          *time.Time `json:"expiresAt"`
+	RevokedAt          *time.Time `json:"-"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	UpdatedAt          time.Time  `json:"updatedAt"`
+}
+
+func (link *ShareLink) AfterFind(tx *gorm.DB) error {
+	link.Protected = link.PasswordHash != nil
+	return nil
+}
+
+func (link *ShareLink) GenerateToken() error {
+	token, hash, err := newToken(ShareTokenPrefix)
+	if err != nil {
+		return err
+	}
+	link.Token, link.TokenHash = token, hash
+	return nil
+}
+
+func (link *ShareLink) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	value := string(hash)
+	link.PasswordHash = &value
+	link.Protected = true
+	return nil
+}
+
+// Links without a password accept any
+func (link ShareLink) CheckPassword(password string) bool {
+	if link.PasswordHash == nil {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(*link.PasswordHash), []byte(password)) == nil
+}
+
+// SHARE LINK MODEL AND IMPLEMENTATION
+type ShareLinkRepositoryInterface interface {
+	Save(*ShareLink) error
+	Get(documentID uuid.UUID) ([]ShareLink, error)
+	FirstByToken(token string) (*ShareLink, error)
+	Revoke(documentID uuid.UUID, linkID string) error
+}
+
+type ShareLinkRepository struct {
+	db *gorm.DB
+}
+
+func NewShareLinkRepository(db *gorm.DB) ShareLinkRepository {
+	return ShareLinkRepository{
+		db: db,
+	}
+}
+
+func (repo ShareLinkRepository) Save(link *ShareLink) error {
+	if err := repo.db.Save(link).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// Links of the document that were not revoked, expired ones included
+func (repo ShareLinkRepository) Get(documentID uuid.UUID) ([]ShareLink, error) {
+	links := make([]ShareLink, 0)
+	err := repo.db.Where("document_id = ? AND revoked_at IS NULL", documentID).
+		Order("created_at asc").
+		Find(&links).Error
+	if err != nil {
+		return links, err
+	}
+	return links, nil
+}
+
+func (repo ShareLinkRepository) FirstByToken(token string) (*ShareLink, error) {
+	var link ShareLink
+	if err := liveToken(repo.db, token).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (repo ShareLinkRepository) Revoke(documentID uuid.UUID, linkID string) error {
+	result := repo.db.Model(&ShareLink{}).
+		Where("id = ? AND document_id = ? AND revoked_at IS NULL", linkID, documentID).
+		Update("revoked_at", repo.db.NowFunc())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
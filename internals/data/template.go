@@ -0,0 +1,107 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A page of a template, children become child documents
+type TemplatePage struct {
+	Title      string         `json:"title"`
+	Icon       *string        `json:"icon"`
+	CoverImage *string        `json:"coverImage"`
+	Content    *string        `json:"content"`
+	MdContent  *string        `json:"mdContent"`
+	Children   []TemplatePage `json:"children,omitempty"`
+}
+
+func (page TemplatePage) NewDocument(userID string) Document {
+	return Document{
+		Title:      page.Title,
+		UserID:     userID,
+		Icon:       page.Icon,
+		CoverImage: page.CoverImage,
+		Content:    page.Content,
+		MdContent:  page.MdContent,
+	}
+}
+
+// Build a page tree out of root and its descendants, as returned by
+// DocumentRepository.Subtree (parents before children)
+func NewTemplatePage(root Document, subtree []Document) TemplatePage {
+	children := map[string][]Document{}
+	for _, doc := range subtree {
+		if doc.ParentDocumentID != nil {
+			children[*doc.ParentDocumentID] = append(children[*doc.ParentDocumentID], doc)
+		}
+	}
+
+	var build func(doc Document) TemplatePage
+	build = func(doc Document) TemplatePage {
+		page := TemplatePage{
+			Title:      doc.Title,
+			Icon:       doc.Icon,
+			CoverImage: doc.CoverImage,
+			Content:    doc.Content,
+			MdContent:  doc.MdContent,
+		}
+		for _, child := range children[doc.ID.String()] {
+			page.Children = append(page.Children, build(child))
+		}
+		return page
+	}
+	return build(root)
+}
+
+// TYPEDEF Templates
+type Template struct {
+	ID          string       `gorm:"type:uuid;default:gen_random_uuid()" json:"id"`
+	UserID      *string      `gorm:"index" json:"userId"` // nil for built-in templates
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Page        TemplatePage `gorm:"type:jsonb;serializer:json" json:"page"`
+	BuiltIn     bool         `gorm:"-" json:"builtIn"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+// TEMPLATE MODEL AND IMPLEMENTATION
+type TemplateRepositoryInterface interface {
+	Save(*Template) error
+	Get(userID string) ([]Template, error)
+	First(userID string, templateID string) (*Template, error)
+}
+
+type TemplateRepository struct {
+	db *gorm.DB
+}
+
+func NewTemplateRepository(db *gorm.DB) TemplateRepository {
+	return TemplateRepository{
+		db: db,
+	}
+}
+
+func (repo TemplateRepository) Save(template *Template) error {
+	if err := repo.db.Save(template).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (repo TemplateRepository) Get(userID string) ([]Template, error) {
+	templates := make([]Template, 0)
+	if err := repo.db.Where("user_id = ?", userID).Order("name asc").Find(&templates).Error; err != nil {
+		return templates, err
+	}
+	return templates, nil
+}
+
+func (repo TemplateRepository) First(userID string, templateID string) (*Template, error) {
+	var template Template
+	if err := repo.db.First(&template, "user_id = ? AND id = ?", userID, templateID).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
@@ -0,0 +1,36 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"gorm.io/gorm"
+)
+
+// Bearer tokens of share links and API tokens. Only their hash is stored, the
+// token itself is returned once, on creation.
+
+// Random token made of prefix and 32 random bytes, and the hash to store
+func newToken(prefix string) (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := prefix + base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashToken(token), nil
+}
+
+// Tokens are random enough for a plain SHA-256 to be safe to look up by
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Rows matching token that are neither revoked nor expired. Dead tokens are
+// then reported as gorm.ErrRecordNotFound, like unknown ones.
+func liveToken(db *gorm.DB, token string) *gorm.DB {
+	return db.Where("token_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)",
+		hashToken(token), db.NowFunc())
+}
@@ -0,0 +1,234 @@
+package data
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Role of a member in a workspace
+type WorkspaceRole string
+
+const (
+	WorkspaceOwner  WorkspaceRole = "owner"
+	WorkspaceAdmin  WorkspaceRole = "admin"
+	WorkspaceMember WorkspaceRole = "member"
+)
+
+var workspaceRoleRanks = map[WorkspaceRole]int{
+	WorkspaceMember: 1,
+	WorkspaceAdmin:  2,
+	WorkspaceOwner:  3,
+}
+
+// Whether role grants at least what other does
+func (role WorkspaceRole) Includes(other WorkspaceRole) bool {
+	return workspaceRoleRanks[role] >= workspaceRoleRanks[other]
+}
+
+// Role the member holds on every document of the workspace: admins manage
+// them like owners, members edit them
+func (role WorkspaceRole) DocumentRole() Role {
+	switch role {
+	case WorkspaceOwner, WorkspaceAdmin:
+		return RoleOwner
+	case WorkspaceMember:
+		return RoleEditor
+	default:
+		return RoleNone
+	}
+}
+
+// TYPEDEF Workspaces
+// A space documents live in. Every user has a personal workspace, teams share
+// the others, which can mirror a Clerk organization.
+type Workspace struct {
+	ID                  uuid.UUID `gorm:"type:uuid;default:gen_random_uuid()" json:"id"`
+	Name                string    `json:"name"`
+	PersonalOwnerID     *string   `json:"personalOwnerId"`
+	ClerkOrganizationID *string   `json:"clerkOrganizationId"`
+	CreatedAt           time.Time `json:"createdAt"`
+	UpdatedAt           time.Time `json:"updatedAt"`
+}
+
+// Memberships mirrored from a Clerk organization carry an ExpiresAt, renewed
+// by the sessions of the member (see Sync). Once it passes the membership is
+// ignored, so people removed from the organization lose access.
+type WorkspaceMembership struct {
+	ID          uuid.UUID     `gorm:"type:uuid;default:gen_random_uuid()" json:"id"`
+	WorkspaceID uuid.UUID     `gorm:"type:uuid" json:"workspaceId"`
+	UserID      string        `json:"userId"`
+	Role        WorkspaceRole `json:"role"`
+	ExpiresAt   *time.Time    `json:"expiresAt"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	UpdatedAt   time.Time     `json:"updatedAt"`
+}
+
+func (WorkspaceMembership) TableName() string {
+	return "workspace_members"
+}
+
+// Condition on workspace_members that leaves out lapsed memberships
+const liveMembership = "(workspace_members.expires_at IS NULL OR workspace_members.expires_at > NOW())"
+
+// WORKSPACE MODEL AND IMPLEMENTATION
+type WorkspaceRepositoryInterface interface {
+	Save(workspace *Workspace, ownerID string) error
+	First(workspaceID string) (*Workspace, error)
+	Get(userID string) ([]Workspace, error)
+	Personal(userID string) (*Workspace, error)
+	Organization(organizationID, name string) (*Workspace, error)
+	Join(workspaceID uuid.UUID, userID string, role WorkspaceRole) (*WorkspaceMembership, error)
+	Sync(workspaceID uuid.UUID, userID string, role WorkspaceRole, expiresAt time.Time) (*WorkspaceMembership, error)
+	Leave(workspaceID uuid.UUID, userID string) error
+	Member(workspaceID uuid.UUID, userID string) (*WorkspaceMembership, error)
+	Members(workspaceID uuid.UUID) ([]WorkspaceMembership, error)
+}
+
+type WorkspaceRepository struct {
+	db *gorm.DB
+}
+
+func NewWorkspaceRepository(db *gorm.DB) WorkspaceRepository {
+	return WorkspaceRepository{
+		db: db,
+	}
+}
+
+// Create workspace with ownerID as its first member
+func (repo WorkspaceRepository) Save(workspace *Workspace, ownerID string) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(workspace).Error; err != nil {
+			return err
+		}
+		_, err := NewWorkspaceRepository(tx).Join(workspace.ID, ownerID, WorkspaceOwner)
+		return err
+	})
+}
+
+func (repo WorkspaceRepository) First(workspaceID string) (*Workspace, error) {
+	var workspace Workspace
+	if err := repo.db.First(&workspace, "id = ?", workspaceID).Error; err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// Workspaces userID is a member of, the personal one first
+func (repo WorkspaceRepository) Get(userID string) ([]Workspace, error) {
+	workspaces := make([]Workspace, 0)
+	err := repo.db.
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ? AND "+liveMembership, userID).
+		Order("workspaces.personal_owner_id IS NULL, workspaces.name asc").
+		Find(&workspaces).Error
+	if err != nil {
+		return workspaces, err
+	}
+	return workspaces, nil
+}
+
+// The personal workspace of userID, created on first use
+func (repo WorkspaceRepository) Personal(userID string) (*Workspace, error) {
+	return repo.firstOrCreate("personal_owner_id", userID, Workspace{
+		Name:            "Personal",
+		PersonalOwnerID: &userID,
+	}, userID)
+}
+
+// The workspace mirroring a Clerk organization, created on first use
+func (repo WorkspaceRepository) Organization(organizationID, name string) (*Workspace, error) {
+	return repo.firstOrCreate("clerk_organization_id", organizationID, Workspace{
+		Name:                name,
+		ClerkOrganizationID: &organizationID,
+	}, "")
+}
+
+// Concurrent first uses race on the unique column, the loser reads the row
+// the winner created
+func (repo WorkspaceRepository) firstOrCreate(column, value string, workspace Workspace, ownerID string) (*Workspace, error) {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&workspace)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return tx.First(&workspace, column+" = ?", value).Error
+		}
+		if ownerID == "" {
+			return nil
+		}
+		_, err := NewWorkspaceRepository(tx).Join(workspace.ID, ownerID, WorkspaceOwner)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// Add userID to the workspace, or change their role if already a member
+func (repo WorkspaceRepository) Join(workspaceID uuid.UUID, userID string, role WorkspaceRole) (*WorkspaceMembership, error) {
+	membership := WorkspaceMembership{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Role:        role,
+	}
+	err := repo.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "workspace_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+	}).Create(&membership).Error
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// Add or renew the membership of userID mirrored from a Clerk organization,
+// valid until expiresAt
+func (repo WorkspaceRepository) Sync(workspaceID uuid.UUID, userID string, role WorkspaceRole, expiresAt time.Time) (*WorkspaceMembership, error) {
+	membership := WorkspaceMembership{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Role:        role,
+		ExpiresAt:   &expiresAt,
+	}
+	err := repo.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "workspace_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "expires_at", "updated_at"}),
+	}).Create(&membership).Error
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// Returns gorm.ErrRecordNotFound when userID is not a member
+func (repo WorkspaceRepository) Leave(workspaceID uuid.UUID, userID string) error {
+	result := repo.db.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Delete(&WorkspaceMembership{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (repo WorkspaceRepository) Member(workspaceID uuid.UUID, userID string) (*WorkspaceMembership, error) {
+	var membership WorkspaceMembership
+	if err := repo.db.First(&membership, "workspace_id = ? AND user_id = ? AND "+liveMembership, workspaceID, userID).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (repo WorkspaceRepository) Members(workspaceID uuid.UUID) ([]WorkspaceMembership, error) {
+	members := make([]WorkspaceMembership, 0)
+	if err := repo.db.Where("workspace_id = ? AND "+liveMembership, workspaceID).Order("created_at asc").Find(&members).Error; err != nil {
+		return members, err
+	}
+	return members, nil
+}
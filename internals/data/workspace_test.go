@@ -0,0 +1,40 @@
+package data
+
+import "testing"
+
+func TestWorkspaceRoleIncludes(t *testing.T) {
+	tests := []struct {
+		role  WorkspaceRole
+		other WorkspaceRole
+		want  bool
+	}{
+		{WorkspaceMember, WorkspaceMember, true},
+		{WorkspaceMember, WorkspaceAdmin, false},
+		{WorkspaceAdmin, WorkspaceMember, true},
+		{WorkspaceAdmin, WorkspaceOwner, false},
+		{WorkspaceOwner, WorkspaceAdmin, true},
+		{WorkspaceRole("guest"), WorkspaceMember, false},
+	}
+	for _, test := range tests {
+		if got := test.role.Includes(test.other); got != test.want {
+			t.Errorf("%q.Includes(%q) = %v, want %v", test.role, test.other, got, test.want)
+		}
+	}
+}
+
+func TestWorkspaceRoleDocumentRole(t *testing.T) {
+	tests := []struct {
+		role WorkspaceRole
+		want Role
+	}{
+		{WorkspaceOwner, RoleOwner},
+		{WorkspaceAdmin, RoleOwner},
+		{WorkspaceMember, RoleEditor},
+		{WorkspaceRole("guest"), RoleNone},
+	}
+	for _, test := range tests {
+		if got := test.role.DocumentRole(); got != test.want {
+			t.Errorf("%q.DocumentRole() = %q, want %q", test.role, got, test.want)
+		}
+	}
+}
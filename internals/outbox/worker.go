@@ -0,0 +1,206 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"loshon-api/internals/config"
+	"loshon-api/internals/data"
+	"loshon-api/internals/search"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Options struct {
+	BatchSize    int
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+}
+
+func NewOptions(config *config.AppConfig) Options {
+	return Options{
+		BatchSize:    config.OutboxBatchSize,
+		PollInterval: time.Duration(config.OutboxPollSeconds) * time.Second,
+		MaxAttempts:  config.OutboxMaxAttempts,
+		BaseBackoff:  5 * time.Second,
+		MaxBackoff:   10 * time.Minute,
+	}
+}
+
+// Worker drains the search outbox into the search backend. Failed batches are
+// retried with exponential backoff and dead-lettered after MaxAttempts.
+type Worker struct {
+	outbox    data.OutboxRepositoryInterface
+	documents data.DocumentRepositoryInterface
+	indexer   search.Indexer
+	indexName string
+	options   Options
+}
+
+func NewWorker(
+	outbox data.OutboxRepositoryInterface,
+	documents data.DocumentRepositoryInterface,
+	indexer search.Indexer,
+	indexName string,
+	options Options,
+) *Worker {
+	return &Worker{
+		outbox:    outbox,
+		documents: documents,
+		indexer:   indexer,
+		indexName: indexName,
+		options:   options,
+	}
+}
+
+// Poll the outbox until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	slog.Info("outbox worker started", slog.String("index", w.indexName))
+	ticker := time.NewTicker(w.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.Drain(); err != nil {
+			slog.Error("outbox drain failed", slog.String("error", err.Error()))
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("outbox worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process batches until no due entry is left. Returns the number of entries
+// handled, successfully or not.
+func (w *Worker) Drain() (int, error) {
+	total := 0
+	for {
+		n, err := w.processBatch()
+		total += n
+		if err != nil || n < w.options.BatchSize {
+			return total, err
+		}
+	}
+}
+
+// Claim, index and settle one batch inside a single transaction, so the rows
+// stay locked while the search backend is called
+func (w *Worker) processBatch() (int, error) {
+	claimed := 0
+	err := w.outbox.Transaction(func(tx data.OutboxRepositoryInterface) error {
+		entries, err := tx.Claim(w.options.BatchSize)
+		if err != nil {
+			return err
+		}
+		claimed = len(entries)
+		if claimed == 0 {
+			return nil
+		}
+
+		ids := make([]int64, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		if err := w.index(entries); err != nil {
+			return w.fail(tx, entries, ids, err)
+		}
+		return tx.Complete(ids)
+	})
+	return claimed, err
+}
+
+func (w *Worker) index(entries []data.OutboxEntry) error {
+	// several entries for a document collapse into a single write, the most
+	// recent operation wins since entries are claimed in order
+	latest := map[uuid.UUID]data.IndexOperation{}
+	order := []uuid.UUID{}
+	for _, entry := range entries {
+		if _, ok := latest[entry.DocumentID]; !ok {
+			order = append(order, entry.DocumentID)
+		}
+		latest[entry.DocumentID] = entry.Operation
+	}
+	saves, deletes := []uuid.UUID{}, []string{}
+	for _, id := range order {
+		if latest[id] == data.IndexDelete {
+			deletes = append(deletes, id.String())
+		} else {
+			saves = append(saves, id)
+		}
+	}
+
+	documents, err := w.documents.Find(saves)
+	if err != nil {
+		return err
+	}
+	// a document deleted or purged since its save was queued leaves the index
+	found := make(map[uuid.UUID]bool, len(documents))
+	objects := make([]map[string]any, 0, len(documents))
+	for _, doc := range documents {
+		found[doc.ID] = true
+		if doc.DeletedAt.Valid {
+			deletes = append(deletes, doc.ID.String())
+			continue
+		}
+		objects = append(objects, doc.ToSearchObject())
+	}
+	for _, id := range saves {
+		if !found[id] {
+			deletes = append(deletes, id.String())
+		}
+	}
+
+	if len(objects) > 0 {
+		if err := w.indexer.Reindex(w.indexName, objects); err != nil {
+			return err
+		}
+	}
+	if len(deletes) > 0 {
+		return w.indexer.DeleteObjects(w.indexName, deletes)
+	}
+	return nil
+}
+
+// The whole batch shares the fate of the failed index call. Entries that used
+// up their attempts are buried, the others retried after a backoff.
+func (w *Worker) fail(tx data.OutboxRepositoryInterface, entries []data.OutboxEntry, ids []int64, cause error) error {
+	retry, bury := []int64{}, []int64{}
+	attempts := 0
+	for _, entry := range entries {
+		if entry.Attempts+1 >= w.options.MaxAttempts {
+			bury = append(bury, entry.ID)
+		} else {
+			retry = append(retry, entry.ID)
+			attempts = max(attempts, entry.Attempts+1)
+		}
+	}
+	slog.Warn("outbox batch failed",
+		slog.Int("entries", len(ids)),
+		slog.Int("buried", len(bury)),
+		slog.String("error", cause.Error()),
+	)
+
+	if len(retry) > 0 {
+		if err := tx.Retry(retry, cause.Error(), time.Now().UTC().Add(w.backoff(attempts))); err != nil {
+			return err
+		}
+	}
+	if len(bury) > 0 {
+		if err := tx.Bury(bury, cause.Error()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BaseBackoff doubled per attempt, capped at MaxBackoff
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.options.BaseBackoff
+	for i := 1; i < attempts && delay < w.options.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, w.options.MaxBackoff)
+}
@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"loshon-api/internals/data"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+)
+
+// Action a user attempts on a document
+type Action string
+
+const (
+	// read the document and its ancestors
+	ActionView Action = "view"
+	// read the revisions of the document, which may predate its publication
+	ActionViewHistory Action = "view_history"
+	// list who the document is shared with
+	ActionViewCollaborators Action = "view_collaborators"
+	// list the subtree of the document, unpublished pages included
+	ActionViewTree Action = "view_tree"
+	// comment on the document
+	ActionComment Action = "comment"
+	// change the content of the document or restore one of its revisions
+	ActionEdit Action = "edit"
+	// archive, restore, delete, move, duplicate, publish and share
+	ActionManage Action = "manage"
+)
+
+// Role needed for each action
+var requiredRoles = map[Action]data.Role{
+	ActionView:              data.RoleViewer,
+	ActionViewHistory:       data.RoleViewer,
+	ActionViewCollaborators: data.RoleViewer,
+	ActionViewTree:          data.RoleViewer,
+	ActionComment:           data.RoleCommenter,
+	ActionEdit:              data.RoleEditor,
+	ActionManage:            data.RoleOwner,
+}
+
+// Actions that need a role the user holds themselves, which neither a
+// published document nor a share link gives
+var explicitActions = map[Action]bool{
+	ActionViewHistory:       true,
+	ActionViewCollaborators: true,
+	ActionViewTree:          true,
+}
+
+// RoleResolver gives the effective role of a user on a document, see
+// data.PermissionRepository
+type RoleResolver interface {
+	Role(doc *data.Document, userID string) (data.Role, error)
+}
+
+type Policy struct {
+	roles RoleResolver
+}
+
+func New(roles RoleResolver) Policy {
+	return Policy{
+		roles: roles,
+	}
+}
+
+// Whether user may perform action on document. Published, non archived
+// documents can be viewed by anyone, everything else depends on the role the
+// user holds. user is nil for anonymous requests, which are denied anything
+// else. Unknown actions are always denied.
+func (policy Policy) Can(user *clerk.User, action Action, document *data.Document) (bool, error) {
+	if action == ActionView && document.IsPublished && !document.IsArchived {
+		return true, nil
+	}
+	if user == nil {
+		return false, nil
+	}
+	role, err := policy.roles.Role(document, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return Allows(role, action), nil
+}
+
+// Whether role is enough to perform action
+func Allows(role data.Role, action Action) bool {
+	required, ok := requiredRoles[action]
+	if !ok {
+		return false
+	}
+	return role.Includes(required)
+}
+
+// Whether a share link of role may perform action. Links open the document
+// itself, never its history or collaborators.
+func AllowsLink(role data.Role, action Action) bool {
+	return !explicitActions[action] && Allows(role, action)
+}
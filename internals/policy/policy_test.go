@@ -0,0 +1,116 @@
+package policy
+
+import (
+	"errors"
+	"loshon-api/internals/data"
+	"testing"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+)
+
+type fixedRoles struct {
+	role data.Role
+	err  error
+}
+
+func (roles fixedRoles) Role(doc *data.Document, userID string) (data.Role, error) {
+	return roles.role, roles.err
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		role   data.Role
+		action Action
+		want   bool
+	}{
+		{data.RoleNone, ActionView, false},
+		{data.RoleViewer, ActionView, true},
+		{data.RoleViewer, ActionViewHistory, true},
+		{data.RoleViewer, ActionViewCollaborators, true},
+		{data.RoleNone, ActionViewTree, false},
+		{data.RoleViewer, ActionViewTree, true},
+		{data.RoleViewer, ActionComment, false},
+		{data.RoleCommenter, ActionComment, true},
+		{data.RoleCommenter, ActionEdit, false},
+		{data.RoleEditor, ActionEdit, true},
+		{data.RoleEditor, ActionManage, false},
+		{data.RoleOwner, ActionManage, true},
+		{data.RoleOwner, Action("unknown"), false},
+	}
+	for _, test := range tests {
+		if got := Allows(test.role, test.action); got != test.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", test.role, test.action, got, test.want)
+		}
+	}
+}
+
+func TestAllowsLink(t *testing.T) {
+	tests := []struct {
+		role   data.Role
+		action Action
+		want   bool
+	}{
+		{data.RoleViewer, ActionView, true},
+		{data.RoleViewer, ActionComment, false},
+		{data.RoleEditor, ActionEdit, true},
+		{data.RoleEditor, ActionViewHistory, false},
+		{data.RoleOwner, ActionViewHistory, false},
+		{data.RoleOwner, ActionViewCollaborators, false},
+		{data.RoleViewer, ActionViewTree, false},
+	}
+	for _, test := range tests {
+		if got := AllowsLink(test.role, test.action); got != test.want {
+			t.Errorf("AllowsLink(%q, %q) = %v, want %v", test.role, test.action, got, test.want)
+		}
+	}
+}
+
+func TestCan(t *testing.T) {
+	user := &clerk.User{ID: "user_1"}
+	published := &data.Document{UserID: "user_2", IsPublished: true}
+	archived := &data.Document{UserID: "user_2", IsPublished: true, IsArchived: true}
+	private := &data.Document{UserID: "user_2"}
+
+	tests := []struct {
+		name     string
+		user     *clerk.User
+		role     data.Role
+		action   Action
+		document *data.Document
+		want     bool
+	}{
+		{"anonymous views published", nil, data.RoleNone, ActionView, published, true},
+		{"anonymous views archived", nil, data.RoleNone, ActionView, archived, false},
+		{"anonymous views private", nil, data.RoleNone, ActionView, private, false},
+		{"anonymous history of published", nil, data.RoleNone, ActionViewHistory, published, false},
+		{"stranger history of published", user, data.RoleNone, ActionViewHistory, published, false},
+		{"stranger collaborators of published", user, data.RoleNone, ActionViewCollaborators, published, false},
+		{"stranger tree of published", user, data.RoleNone, ActionViewTree, published, false},
+		{"viewer tree", user, data.RoleViewer, ActionViewTree, private, true},
+		{"stranger edits published", user, data.RoleNone, ActionEdit, published, false},
+		{"viewer history", user, data.RoleViewer, ActionViewHistory, private, true},
+		{"viewer edits", user, data.RoleViewer, ActionEdit, private, false},
+		{"editor edits", user, data.RoleEditor, ActionEdit, private, true},
+		{"editor manages", user, data.RoleEditor, ActionManage, private, false},
+		{"owner manages archived", user, data.RoleOwner, ActionManage, archived, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed, err := New(fixedRoles{role: test.role}).Can(test.user, test.action, test.document)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if allowed != test.want {
+				t.Errorf("got %v, want %v", allowed, test.want)
+			}
+		})
+	}
+}
+
+func TestCanResolverError(t *testing.T) {
+	failure := errors.New("connection refused")
+	_, err := New(fixedRoles{err: failure}).Can(&clerk.User{ID: "user_1"}, ActionEdit, &data.Document{})
+	if !errors.Is(err, failure) {
+		t.Errorf("got %v, want %v", err, failure)
+	}
+}
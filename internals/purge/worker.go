@@ -0,0 +1,81 @@
+package purge
+
+import (
+	"context"
+	"log/slog"
+	"loshon-api/internals/config"
+	"loshon-api/internals/data"
+	"time"
+)
+
+type Options struct {
+	Retention time.Duration
+	Interval  time.Duration
+	BatchSize int
+}
+
+func NewOptions(config *config.AppConfig) Options {
+	return Options{
+		Retention: time.Duration(config.TrashRetentionDays) * 24 * time.Hour,
+		Interval:  time.Duration(config.PurgeIntervalMinutes) * time.Minute,
+		BatchSize: config.PurgeBatchSize,
+	}
+}
+
+// Worker permanently removes documents that stayed in the trash longer than
+// the retention period
+type Worker struct {
+	documents data.DocumentRepositoryInterface
+	options   Options
+}
+
+func NewWorker(documents data.DocumentRepositoryInterface, options Options) *Worker {
+	return &Worker{
+		documents: documents,
+		options:   options,
+	}
+}
+
+// Purge every Interval until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	slog.Info("purge worker started", slog.Duration("retention", w.options.Retention))
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.Purge(); err != nil {
+			slog.Error("trash purge failed", slog.String("error", err.Error()))
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("purge worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Delete the expired documents batch after batch, leaves first, until none is
+// left. Returns the number of documents removed.
+func (w *Worker) Purge() (int, error) {
+	started := time.Now()
+	cutoff := started.UTC().Add(-w.options.Retention)
+	total, batches := 0, 0
+	for {
+		ids, err := w.documents.Purge(cutoff, w.options.BatchSize)
+		total += len(ids)
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		batches++
+	}
+	slog.Info("trash purged",
+		slog.Int("documents", total),
+		slog.Int("batches", batches),
+		slog.Time("cutoff", cutoff),
+		slog.Duration("took", time.Since(started)),
+	)
+	return total, nil
+}
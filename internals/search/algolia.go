@@ -0,0 +1,188 @@
+package search
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/algolia/algoliasearch-client-go/v4/algolia/search"
+)
+
+type SearchClient struct {
+	client *search.APIClient
+	appID  string
+	apiKey string
+	keys   *securedKeyCache
+}
+
+func NewSearchClient(appID, apiKey string) (*SearchClient, error) {
+	client, err := search.NewClient(appID, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchClient{
+		client: client,
+		appID:  appID,
+		apiKey: apiKey,
+		keys:   newSecuredKeyCache(),
+	}, nil
+}
+
+func (search SearchClient) Reindex(indexName string, data []map[string]any) error {
+	resps, err := search.client.SaveObjects(indexName, data)
+	if err != nil {
+		return err
+	}
+	for _, resp := range resps {
+		slog.Info("object indexed", slog.Attr{Key: "objectID", Value: slog.StringValue(strings.Join(resp.ObjectIDs, ", "))})
+	}
+	return nil
+}
+
+func (sclient SearchClient) SaveObject(indexName string, data map[string]any) error {
+	resp, err := sclient.client.SaveObject(
+		sclient.client.NewApiSaveObjectRequest(indexName, data),
+	)
+	if err != nil {
+		return err
+	}
+	slog.Info("search object saved", slog.Attr{
+		Key:   "resp",
+		Value: slog.StringValue(resp.String()),
+	})
+	return nil
+}
+
+func (sclient SearchClient) DeleteObjects(indexName string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err := sclient.client.DeleteObjects(indexName, ids); err != nil {
+		return err
+	}
+	slog.Info("search objects deleted", slog.Attr{Key: "objectID", Value: slog.StringValue(strings.Join(ids, ", "))})
+	return nil
+}
+
+// Page through the index with the browse cursor, retrieving nothing but the
+// object IDs
+func (sclient SearchClient) BrowseObjectIDs(indexName, userID string, fn func(ids []string) error) error {
+	params := search.NewEmptyBrowseParamsObject().
+		SetAttributesToRetrieve([]string{"objectID"}).
+		SetHitsPerPage(1000)
+	if userID != "" {
+		params.SetFilters(fmt.Sprintf("userId:%q", userID))
+	}
+	for {
+		resp, err := sclient.client.Browse(
+			sclient.client.NewApiBrowseRequest(indexName).
+				WithBrowseParams(search.BrowseParamsObjectAsBrowseParams(params)),
+		)
+		if err != nil {
+			return err
+		}
+		ids := make([]string, 0, len(resp.Hits))
+		for _, hit := range resp.Hits {
+			ids = append(ids, hit.ObjectID)
+		}
+		if len(ids) > 0 {
+			if err := fn(ids); err != nil {
+				return err
+			}
+		}
+		if resp.Cursor == nil || *resp.Cursor == "" {
+			return nil
+		}
+		params.SetCursor(*resp.Cursor)
+	}
+}
+
+// Filtering on userId, isPublished, isArchived and isDeleted requires them to
+// be declared in the index attributesForFaceting (filterOnly is enough)
+func (sclient SearchClient) Search(indexName string, query Query) (*Result, error) {
+	params := search.NewEmptySearchParamsObject().
+		SetQuery(query.Text).
+		SetFilters(searchFilters(query)).
+		SetHitsPerPage(int32(query.Limit)).
+		SetAttributesToRetrieve([]string{"objectID", "userId", "title", "icon", "isArchived", "isPublished"}).
+		SetAttributesToHighlight([]string{"title"}).
+		SetAttributesToSnippet([]string{"content:30"}).
+		SetHighlightPreTag(highlightStart).
+		SetHighlightPostTag(highlightStop)
+	resp, err := sclient.client.SearchSingleIndex(
+		sclient.client.NewApiSearchSingleIndexRequest(indexName).
+			WithSearchParams(search.SearchParamsObjectAsSearchParams(params)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	result := Result{
+		Hits: make([]Hit, 0, len(resp.Hits)),
+	}
+	if resp.NbHits != nil {
+		result.Total = int(*resp.NbHits)
+	}
+	for _, h := range resp.Hits {
+		hit := Hit{ID: h.ObjectID}
+		hit.UserID, _ = h.AdditionalProperties["userId"].(string)
+		hit.Title, _ = h.AdditionalProperties["title"].(string)
+		hit.IsArchived, _ = h.AdditionalProperties["isArchived"].(bool)
+		hit.IsPublished, _ = h.AdditionalProperties["isPublished"].(bool)
+		if icon, ok := h.AdditionalProperties["icon"].(string); ok {
+			hit.Icon = &icon
+		}
+		if h.HighlightResult != nil {
+			if title, ok := (*h.HighlightResult)["title"]; ok && title.HighlightResultOption != nil {
+				hit.Highlight = escapeHighlight(title.HighlightResultOption.Value)
+			}
+		}
+		if h.SnippetResult != nil {
+			if content, ok := (*h.SnippetResult)["content"]; ok && content.SnippetResultOption != nil {
+				hit.Snippet = escapeHighlight(content.SnippetResultOption.Value)
+			}
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	return &result, nil
+}
+
+// Algolia filters cannot OR two AND groups, so "own, or published and not
+// archived" is spelled as an AND of OR groups
+func searchFilters(query Query) string {
+	filters := fmt.Sprintf("isDeleted:false AND (userId:%q OR isPublished:true)", query.UserID)
+	if query.IncludeArchived {
+		return filters + fmt.Sprintf(" AND (userId:%q OR isArchived:false)", query.UserID)
+	}
+	return filters + " AND isArchived:false"
+}
+
+// Derive a key from the parent API key that can only search indexName for
+// the non deleted documents of userID and expires after ttl. Keys are cached
+// and handed out again until they get close to their expiry.
+func (sclient SearchClient) SecuredKey(indexName, userID string, ttl time.Duration) (*SecuredKey, error) {
+	if key, ok := sclient.keys.get(indexName, userID, ttl); ok {
+		return key, nil
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	restrictions := search.NewSecuredApiKeyRestrictions(
+		search.WithSecuredApiKeyRestrictionsFilters(fmt.Sprintf("userId:%q AND isDeleted:false", userID)),
+		search.WithSecuredApiKeyRestrictionsValidUntil(expiresAt.Unix()),
+		search.WithSecuredApiKeyRestrictionsRestrictIndices([]string{indexName}),
+	)
+	value, err := sclient.client.GenerateSecuredApiKey(sclient.apiKey, restrictions)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SecuredKey{
+		Key:       value,
+		AppID:     sclient.appID,
+		IndexName: indexName,
+		ExpiresAt: expiresAt.UTC(),
+	}
+	sclient.keys.put(userID, key)
+	return key, nil
+}
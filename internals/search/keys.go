@@ -0,0 +1,45 @@
+package search
+
+import (
+	"sync"
+	"time"
+)
+
+// securedKeyCache keeps the last key issued per user so repeated page loads
+// do not mint a new key every time
+type securedKeyCache struct {
+	mu   sync.Mutex
+	keys map[string]*SecuredKey
+}
+
+func newSecuredKeyCache() *securedKeyCache {
+	return &securedKeyCache{
+		keys: map[string]*SecuredKey{},
+	}
+}
+
+// A cached key is only reused while it has more than a quarter of ttl left,
+// so clients always get a key that stays valid for a while
+func (cache *securedKeyCache) get(indexName, userID string, ttl time.Duration) (*SecuredKey, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	key, ok := cache.keys[userID]
+	if !ok || key.IndexName != indexName || time.Until(key.ExpiresAt) < ttl/4 {
+		return nil, false
+	}
+	return key, true
+}
+
+func (cache *securedKeyCache) put(userID string, key *SecuredKey) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	// drop expired keys of users that did not come back
+	for id, k := range cache.keys {
+		if time.Now().After(k.ExpiresAt) {
+			delete(cache.keys, id)
+		}
+	}
+	cache.keys[userID] = key
+}
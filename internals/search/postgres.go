@@ -0,0 +1,83 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// PostgresClient searches the documents table directly through the
+// search_vector column, which Postgres keeps up to date on its own. Indexing
+// is therefore a no-op, which makes it a good fit for development, CI and
+// self-hosted deployments without Algolia.
+type PostgresClient struct {
+	db *gorm.DB
+}
+
+func NewPostgresClient(db *gorm.DB) *PostgresClient {
+	return &PostgresClient{
+		db: db,
+	}
+}
+
+func (pg PostgresClient) SaveObject(indexName string, data map[string]any) error {
+	return nil
+}
+
+func (pg PostgresClient) Reindex(indexName string, data []map[string]any) error {
+	return nil
+}
+
+func (pg PostgresClient) DeleteObjects(indexName string, ids []string) error {
+	return nil
+}
+
+func (pg PostgresClient) Search(indexName string, query Query) (*Result, error) {
+	statement := `
+	SELECT documents.id, documents.user_id, documents.title, documents.icon,
+		COALESCE(documents.is_archived, false) AS is_archived,
+		COALESCE(documents.is_published, false) AS is_published,
+		ts_headline('simple', COALESCE(documents.title, ''), q, @title_options) AS highlight,
+		ts_headline('simple', COALESCE(documents.md_content, ''), q, @snippet_options) AS snippet,
+		COUNT(*) OVER() AS total
+		FROM documents, websearch_to_tsquery('simple', @text) q
+		WHERE documents.search_vector @@ q
+			AND documents.deleted_at IS NULL
+			AND (
+				(documents.user_id = @user AND (@archived OR documents.is_archived = false))
+				OR (documents.is_published = true AND documents.is_archived = false)
+			)
+		ORDER BY ts_rank(documents.search_vector, q) DESC, documents.updated_at DESC
+		LIMIT @limit
+	`
+	tags := fmt.Sprintf(`StartSel="%s", StopSel="%s"`, highlightStart, highlightStop)
+	type hitRow struct {
+		Hit
+		Total int
+	}
+	rows := []hitRow{}
+	err := pg.db.Raw(statement,
+		sql.Named("text", query.Text),
+		sql.Named("user", query.UserID),
+		sql.Named("archived", query.IncludeArchived),
+		sql.Named("limit", query.Limit),
+		sql.Named("title_options", tags+", HighlightAll=true"),
+		sql.Named("snippet_options", tags+", MaxFragments=2, MaxWords=30, MinWords=10"),
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// every row carries the number of matches before the limit
+	result := Result{
+		Hits: make([]Hit, 0, len(rows)),
+	}
+	for _, row := range rows {
+		row.Highlight = escapeHighlight(row.Highlight)
+		row.Snippet = escapeHighlight(row.Snippet)
+		result.Hits = append(result.Hits, row.Hit)
+		result.Total = row.Total
+	}
+	return &result, nil
+}
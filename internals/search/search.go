@@ -1,47 +1,112 @@
 package search
 
 import (
-	"log/slog"
+	"fmt"
+	"html"
 	"strings"
+	"time"
 
-	"github.com/algolia/algoliasearch-client-go/v4/algolia/search"
+	"gorm.io/gorm"
 )
 
-type SearchClient struct {
-	client *search.APIClient
+const (
+	BackendAlgolia  = "algolia"
+	BackendPostgres = "postgres"
+)
+
+// Indexer pushes document search objects (see data.Document.ToSearchObject)
+// to the search backend
+type Indexer interface {
+	SaveObject(indexName string, data map[string]any) error
+	Reindex(indexName string, data []map[string]any) error
+	DeleteObjects(indexName string, ids []string) error
 }
 
-func NewSearchClient(appID, apiKey string) (*SearchClient, error) {
-	client, err := search.NewClient(appID, apiKey)
-	if err != nil {
-		return nil, err
-	}
-	return &SearchClient{
-		client: client,
-	}, nil
+// Browser walks the object IDs stored in an index, restricted to userID when
+// it is not empty. fn is called once per page of results.
+type Browser interface {
+	BrowseObjectIDs(indexName, userID string, fn func(ids []string) error) error
 }
 
-func (search SearchClient) Reindex(indexName string, data []map[string]any) error {
-	resps, err := search.client.SaveObjects(indexName, data)
-	if err != nil {
-		return err
-	}
-	for _, resp := range resps {
-		slog.Info("object indexed", slog.Attr{Key: "objectID", Value: slog.StringValue(strings.Join(resp.ObjectIDs, ", "))})
-	}
-	return nil
+// Searcher runs full text queries against the search backend
+type Searcher interface {
+	Search(indexName string, query Query) (*Result, error)
+}
+
+// KeyIssuer hands out short lived keys for searching from the client side,
+// restricted to a single user's documents
+type KeyIssuer interface {
+	SecuredKey(indexName, userID string, ttl time.Duration) (*SecuredKey, error)
+}
+
+type SecuredKey struct {
+	Key       string    `json:"key"`
+	AppID     string    `json:"appId"`
+	IndexName string    `json:"indexName"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type Backend interface {
+	Indexer
+	Searcher
+}
+
+// Query matches the documents owned by UserID plus anything published.
+// Archived documents of the user are only included on request, deleted ones
+// and archived documents of others never are.
+type Query struct {
+	Text            string
+	UserID          string
+	IncludeArchived bool
+	Limit           int
+}
+
+// Highlight and Snippet are HTML, escaped text with the matched fragments
+// wrapped in HighlightPreTag/HighlightPostTag. Title is the plain title.
+type Hit struct {
+	ID          string  `json:"id"`
+	UserID      string  `json:"userId"`
+	Title       string  `json:"title"`
+	Icon        *string `json:"icon"`
+	IsArchived  bool    `json:"isArchived"`
+	IsPublished bool    `json:"isPublished"`
+	Highlight   string  `json:"highlight"`
+	Snippet     string  `json:"snippet"`
+}
+
+const (
+	HighlightPreTag  = "<mark>"
+	HighlightPostTag = "</mark>"
+)
+
+// Backends delimit matches with these control characters, which survive HTML
+// escaping, and escapeHighlight turns them into the tags afterwards
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+var highlightTags = strings.NewReplacer(highlightStart, HighlightPreTag, highlightStop, HighlightPostTag)
+
+// Escape a highlighted value so markup stored in a document is shown as text
+func escapeHighlight(value string) string {
+	return highlightTags.Replace(html.EscapeString(value))
+}
+
+type Result struct {
+	Hits  []Hit
+	Total int
 }
 
-func (sclient SearchClient) SaveObject(indexName string, data map[string]any) error {
-	resp, err := sclient.client.SaveObject(
-		sclient.client.NewApiSaveObjectRequest(indexName, data),
-	)
-	if err != nil {
-		return err
+// Pick the backend named by kind. db is only used by the Postgres backend,
+// the Algolia credentials only by the Algolia one.
+func NewBackend(kind string, appID, apiKey string, db *gorm.DB) (Backend, error) {
+	switch kind {
+	case BackendAlgolia:
+		return NewSearchClient(appID, apiKey)
+	case BackendPostgres:
+		return NewPostgresClient(db), nil
+	default:
+		return nil, fmt.Errorf("unknown search backend %q", kind)
 	}
-	slog.Info("search object saved", slog.Attr{
-		Key:   "resp",
-		Value: slog.StringValue(resp.String()),
-	})
-	return nil
 }
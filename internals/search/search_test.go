@@ -0,0 +1,42 @@
+package search
+
+import "testing"
+
+func TestEscapeHighlight(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plain text", "plain text"},
+		{"a \x02match\x03 here", "a <mark>match</mark> here"},
+		{"<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"\x02<img src=x onerror=alert(1)>\x03", "<mark>&lt;img src=x onerror=alert(1)&gt;</mark>"},
+		{"<mark>fake</mark> & \"quotes\"", "&lt;mark&gt;fake&lt;/mark&gt; &amp; &#34;quotes&#34;"},
+	}
+	for _, test := range tests {
+		if got := escapeHighlight(test.value); got != test.want {
+			t.Errorf("escapeHighlight(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	tests := []struct {
+		query Query
+		want  string
+	}{
+		{
+			Query{UserID: "user_1"},
+			`isDeleted:false AND (userId:"user_1" OR isPublished:true) AND isArchived:false`,
+		},
+		{
+			Query{UserID: "user_1", IncludeArchived: true},
+			`isDeleted:false AND (userId:"user_1" OR isPublished:true) AND (userId:"user_1" OR isArchived:false)`,
+		},
+	}
+	for _, test := range tests {
+		if got := searchFilters(test.query); got != test.want {
+			t.Errorf("searchFilters(%+v) = %s, want %s", test.query, got, test.want)
+		}
+	}
+}
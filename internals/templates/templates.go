@@ -0,0 +1,57 @@
+package templates
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"loshon-api/internals/data"
+	"sort"
+)
+
+/*
+	BUILT-IN TEMPLATES, SHIPPED WITH THE BINARY AND AVAILABLE TO EVERY USER
+*/
+
+//go:embed builtin/*.json
+var builtinFS embed.FS
+
+var builtins = mustLoad()
+
+func mustLoad() map[string]data.Template {
+	entries, err := builtinFS.ReadDir("builtin")
+	if err != nil {
+		panic(fmt.Sprintf("cannot read built-in templates %v", err))
+	}
+
+	templates := make(map[string]data.Template, len(entries))
+	for _, entry := range entries {
+		raw, err := builtinFS.ReadFile("builtin/" + entry.Name())
+		if err != nil {
+			panic(fmt.Sprintf("cannot read built-in template %s %v", entry.Name(), err))
+		}
+		template := data.Template{}
+		if err := json.Unmarshal(raw, &template); err != nil {
+			panic(fmt.Sprintf("invalid built-in template %s %v", entry.Name(), err))
+		}
+		template.BuiltIn = true
+		templates[template.ID] = template
+	}
+	return templates
+}
+
+// All built-in templates, sorted by name
+func BuiltIn() []data.Template {
+	templates := make([]data.Template, 0, len(builtins))
+	for _, template := range builtins {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates
+}
+
+func Find(id string) (data.Template, bool) {
+	template, ok := builtins[id]
+	return template, ok
+}
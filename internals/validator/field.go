@@ -0,0 +1,53 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is a validation failure detected outside of struct tags, e.g.
+// a rule that needs a database lookup. It satisfies validator.FieldError so
+// it can be reported through StructValidationErrors like any tag failure.
+type FieldError struct {
+	field string
+	tag   string
+	param string
+	value interface{}
+}
+
+func NewFieldError(field, tag, param string, value interface{}) *FieldError {
+	return &FieldError{
+		field: field,
+		tag:   tag,
+		param: param,
+		value: value,
+	}
+}
+
+func NewStructValidationErrors(errs ...validator.FieldError) *StructValidationErrors {
+	return &StructValidationErrors{
+		FieldErrors: validator.ValidationErrors(errs),
+	}
+}
+
+func (fe *FieldError) Tag() string             { return fe.tag }
+func (fe *FieldError) ActualTag() string       { return fe.tag }
+func (fe *FieldError) Namespace() string       { return fe.field }
+func (fe *FieldError) StructNamespace() string { return fe.field }
+func (fe *FieldError) Field() string           { return fe.field }
+func (fe *FieldError) StructField() string     { return fe.field }
+func (fe *FieldError) Value() interface{}      { return fe.value }
+func (fe *FieldError) Param() string           { return fe.param }
+func (fe *FieldError) Kind() reflect.Kind      { return reflect.ValueOf(fe.value).Kind() }
+func (fe *FieldError) Type() reflect.Type      { return reflect.TypeOf(fe.value) }
+
+func (fe *FieldError) Translate(ut.Translator) string {
+	return fe.Error()
+}
+
+func (fe *FieldError) Error() string {
+	return fmt.Sprintf("Key: '%s' Error:Field validation for '%s' failed on the '%s' tag", fe.field, fe.field, fe.tag)
+}
@@ -0,0 +1,3 @@
+drop index if exists idx_document_revisions_document_id_created_at;
+
+drop table if exists public.document_revisions cascade;
@@ -0,0 +1,17 @@
+create table
+  public.document_revisions (
+    id uuid not null default gen_random_uuid (),
+    created_at timestamp with time zone null,
+    updated_at timestamp with time zone null,
+    document_id uuid not null,
+    user_id text null,
+    title text null,
+    content text null,
+    md_content text null,
+    cover_image text null,
+    icon text null,
+    constraint document_revisions_pkey primary key (id),
+    constraint fk_document_revisions_document foreign key (document_id) references documents (id) on delete cascade
+  ) tablespace pg_default;
+
+create index if not exists idx_document_revisions_document_id_created_at on public.document_revisions using btree (document_id, created_at desc) tablespace pg_default;
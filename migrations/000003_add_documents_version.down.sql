@@ -0,0 +1,2 @@
+alter table public.documents
+  drop column if exists version;
@@ -0,0 +1,2 @@
+alter table public.documents
+  add column if not exists version bigint not null default 1;
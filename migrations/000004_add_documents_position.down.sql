@@ -0,0 +1,4 @@
+drop index if exists idx_documents_parent_document_id_position;
+
+alter table public.documents
+  drop column if exists position;
@@ -0,0 +1,13 @@
+alter table public.documents
+  add column if not exists position double precision not null default 0;
+
+-- spread existing siblings by creation order, leaving gaps for future moves
+update public.documents d
+  set position = r.rank * 1024
+  from (
+    select id, row_number() over (partition by user_id, parent_document_id order by created_at) as rank
+      from public.documents
+  ) r
+  where r.id = d.id;
+
+create index if not exists idx_documents_parent_document_id_position on public.documents using btree (parent_document_id, position) tablespace pg_default;
@@ -0,0 +1,3 @@
+drop index if exists idx_templates_user_id;
+
+drop table if exists public.templates cascade;
@@ -0,0 +1,13 @@
+create table
+  public.templates (
+    id uuid not null default gen_random_uuid (),
+    created_at timestamp with time zone null,
+    updated_at timestamp with time zone null,
+    user_id text null,
+    name text not null,
+    description text null,
+    page jsonb not null,
+    constraint templates_pkey primary key (id)
+  ) tablespace pg_default;
+
+create index if not exists idx_templates_user_id on public.templates using btree (user_id) tablespace pg_default;
@@ -0,0 +1,4 @@
+drop index if exists idx_documents_search_vector;
+
+alter table public.documents
+  drop column if exists search_vector;
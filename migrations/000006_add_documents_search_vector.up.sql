@@ -0,0 +1,7 @@
+alter table public.documents
+  add column if not exists search_vector tsvector generated always as (
+    setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(md_content, '')), 'B')
+  ) stored;
+
+create index if not exists idx_documents_search_vector on public.documents using gin (search_vector) tablespace pg_default;
@@ -0,0 +1,3 @@
+drop index if exists idx_search_outbox_pending;
+
+drop table if exists public.search_outbox cascade;
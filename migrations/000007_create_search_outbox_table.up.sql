@@ -0,0 +1,16 @@
+create table
+  public.search_outbox (
+    id bigserial not null,
+    created_at timestamp with time zone null,
+    updated_at timestamp with time zone null,
+    document_id uuid not null,
+    operation text not null,
+    attempts integer not null default 0,
+    available_at timestamp with time zone not null default now(),
+    last_error text null,
+    dead_at timestamp with time zone null,
+    constraint search_outbox_pkey primary key (id)
+  ) tablespace pg_default;
+
+create index if not exists idx_search_outbox_pending on public.search_outbox using btree (available_at, id) tablespace pg_default
+  where dead_at is null;
@@ -0,0 +1,4 @@
+drop index if exists idx_documents_archive_batch_id;
+
+alter table public.documents
+  drop column if exists archive_batch_id;
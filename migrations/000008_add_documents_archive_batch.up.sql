@@ -0,0 +1,4 @@
+alter table public.documents
+  add column if not exists archive_batch_id uuid null;
+
+create index if not exists idx_documents_archive_batch_id on public.documents using btree (archive_batch_id) tablespace pg_default;
@@ -0,0 +1,3 @@
+drop index if exists idx_document_permissions_user_id;
+
+drop table if exists public.document_permissions cascade;
@@ -0,0 +1,15 @@
+create table
+  public.document_permissions (
+    id uuid not null default gen_random_uuid (),
+    created_at timestamp with time zone null,
+    updated_at timestamp with time zone null,
+    document_id uuid not null,
+    user_id text not null,
+    role text not null,
+    granted_by text null,
+    constraint document_permissions_pkey primary key (id),
+    constraint document_permissions_document_user_key unique (document_id, user_id),
+    constraint fk_document_permissions_document foreign key (document_id) references documents (id) on delete cascade
+  ) tablespace pg_default;
+
+create index if not exists idx_document_permissions_user_id on public.document_permissions using btree (user_id) tablespace pg_default;
@@ -0,0 +1,3 @@
+drop index if exists idx_share_links_document_id;
+
+drop table if exists public.share_links cascade;
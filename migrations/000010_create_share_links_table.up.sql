@@ -0,0 +1,19 @@
+create table
+  public.share_links (
+    id uuid not null default gen_random_uuid (),
+    created_at timestamp with time zone null,
+    updated_at timestamp with time zone null,
+    document_id uuid not null,
+    created_by text not null,
+    token_hash text not null,
+    role text not null,
+    password_hash text null,
+    include_descendants boolean not null default false,
+    expires_at timestamp with time zone null,
+    revoked_at timestamp with time zone null,
+    constraint share_links_pkey primary key (id),
+    constraint share_links_token_hash_key unique (token_hash),
+    constraint fk_share_links_document foreign key (document_id) references documents (id) on delete cascade
+  ) tablespace pg_default;
+
+create index if not exists idx_share_links_document_id on public.share_links using btree (document_id) tablespace pg_default;
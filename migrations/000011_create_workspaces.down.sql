@@ -0,0 +1,11 @@
+drop index if exists idx_documents_workspace_id;
+
+alter table public.documents
+  drop constraint if exists fk_documents_workspace,
+  drop column if exists workspace_id;
+
+drop index if exists idx_workspace_members_user_id;
+
+drop table if exists public.workspace_members cascade;
+
+drop table if exists public.workspaces cascade;
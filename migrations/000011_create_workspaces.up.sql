@@ -0,0 +1,48 @@
+create table
+  public.workspaces (
+    id uuid not null default gen_random_uuid (),
+    created_at timestamp with time zone null,
+    updated_at timestamp with time zone null,
+    name text not null,
+    personal_owner_id text null,
+    clerk_organization_id text null,
+    constraint workspaces_pkey primary key (id),
+    constraint workspaces_personal_owner_id_key unique (personal_owner_id),
+    constraint workspaces_clerk_organization_id_key unique (clerk_organization_id)
+  ) tablespace pg_default;
+
+create table
+  public.workspace_members (
+    id uuid not null default gen_random_uuid (),
+    created_at timestamp with time zone null,
+    updated_at timestamp with time zone null,
+    workspace_id uuid not null,
+    user_id text not null,
+    role text not null,
+    constraint workspace_members_pkey primary key (id),
+    constraint workspace_members_workspace_user_key unique (workspace_id, user_id),
+    constraint fk_workspace_members_workspace foreign key (workspace_id) references workspaces (id) on delete cascade
+  ) tablespace pg_default;
+
+create index if not exists idx_workspace_members_user_id on public.workspace_members using btree (user_id) tablespace pg_default;
+
+alter table public.documents
+  add column if not exists workspace_id uuid null,
+  add constraint fk_documents_workspace foreign key (workspace_id) references workspaces (id);
+
+create index if not exists idx_documents_workspace_id on public.documents using btree (workspace_id) tablespace pg_default;
+
+-- every existing author gets a personal workspace holding their documents
+insert into public.workspaces (created_at, updated_at, name, personal_owner_id)
+  select now(), now(), 'Personal', authors.user_id
+    from (select distinct user_id from public.documents where user_id is not null) authors;
+
+insert into public.workspace_members (created_at, updated_at, workspace_id, user_id, role)
+  select now(), now(), workspaces.id, workspaces.personal_owner_id, 'owner'
+    from public.workspaces
+    where workspaces.personal_owner_id is not null;
+
+update public.documents
+  set workspace_id = workspaces.id
+  from public.workspaces
+  where workspaces.personal_owner_id = documents.user_id;
@@ -0,0 +1,3 @@
+drop index if exists idx_api_tokens_user_id;
+
+drop table if exists public.api_tokens cascade;
@@ -0,0 +1,17 @@
+create table
+  public.api_tokens (
+    id uuid not null default gen_random_uuid (),
+    created_at timestamp with time zone null,
+    updated_at timestamp with time zone null,
+    user_id text not null,
+    name text not null,
+    token_hash text not null,
+    scope text not null,
+    expires_at timestamp with time zone null,
+    last_used_at timestamp with time zone null,
+    revoked_at timestamp with time zone null,
+    constraint api_tokens_pkey primary key (id),
+    constraint api_tokens_token_hash_key unique (token_hash)
+  ) tablespace pg_default;
+
+create index if not exists idx_api_tokens_user_id on public.api_tokens using btree (user_id) tablespace pg_default;
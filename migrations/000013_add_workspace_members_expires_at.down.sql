@@ -0,0 +1,2 @@
+alter table public.workspace_members
+  drop column if exists expires_at;
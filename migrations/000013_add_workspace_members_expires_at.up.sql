@@ -0,0 +1,3 @@
+-- memberships mirrored from a Clerk organization lapse unless a session renews them
+alter table public.workspace_members
+  add column if not exists expires_at timestamp with time zone null;